@@ -0,0 +1,603 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/catalog"
+	"github.com/october-os/october-installer/pkg/firmware"
+	"github.com/october-os/october-installer/pkg/hostname"
+	"github.com/october-os/october-installer/pkg/installer"
+	"github.com/october-os/october-installer/pkg/locale"
+	"github.com/october-os/october-installer/pkg/mirrors"
+	"github.com/october-os/october-installer/pkg/partition"
+	"github.com/october-os/october-installer/pkg/payload"
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/timezone"
+	"github.com/october-os/october-installer/pkg/user"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+// Default payload file written by the interactive mode.
+const defaultPayloadFile string = "payload.json"
+
+// Asks every value of the payload on the terminal, then either
+// installs it or saves it as JSON.
+//
+// Returns the exit status of the installer.
+func runInteractive(host runner.Runner, opts installer.Options) int {
+	pr := newPrompter()
+	pr.printf("October OS installer\n\nPress Ctrl+C at any time to quit without changing anything.\n")
+
+	p, err := askPayload(pr, host)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if report := p.Check(host); !report.Valid() {
+		fmt.Fprintln(os.Stderr, report)
+		return exitInvalidPayload
+	}
+
+	pr.printf("\n")
+	action, err := pr.choose("What should be done with this configuration", []string{
+		"Install it now",
+		"Save it as a payload file",
+	}, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if action == 1 {
+		return savePayload(pr, p)
+	}
+
+	pr.printf("\n")
+	for _, d := range p.Drives {
+		if d.Append {
+			pr.printf("New partitions will be added to %s\n", d.Path)
+		} else {
+			pr.printf("Every partition of %s will be ERASED\n", d.Path)
+		}
+	}
+	confirmed, err := pr.confirm("Start the installation", false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if !confirmed {
+		pr.printf("Nothing was changed\n")
+		return exitSuccess
+	}
+
+	return install(host, p, opts)
+}
+
+// Asks every value of the payload.
+func askPayload(pr *prompter, host runner.Runner) (*payload.Payload, error) {
+	var p payload.Payload
+	var err error
+
+	pr.printf("\n== Disks ==\n")
+	if p.Drives, err = askDrives(pr, host); err != nil {
+		return nil, err
+	}
+
+	pr.printf("\n== Mirrors ==\n")
+	if p.Mirrors, err = askMirrors(pr, host); err != nil {
+		return nil, err
+	}
+
+	pr.printf("\n== Timezone ==\n")
+	if p.Timezone, err = askTimezone(pr, host); err != nil {
+		return nil, err
+	}
+
+	pr.printf("\n== Locale ==\n")
+	if p.Locale, err = askLocale(pr, host); err != nil {
+		return nil, err
+	}
+
+	pr.printf("\n== Hostname ==\n")
+	p.Hostname, err = pr.askValid("Hostname", "october", func(answer string) error {
+		if err := hostname.ValidateHostname(answer); err != nil {
+			return errors.New("The hostname must be 1 to 63 lowercase letters, digits or hyphens, not starting nor ending with a hyphen")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pr.printf("\n== Users ==\n")
+	if p.RootPassword, err = pr.askPassword("Root password"); err != nil {
+		return nil, err
+	}
+	if p.Users, err = askUsers(pr); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Asks the disks to install on and their partitions.
+func askDrives(pr *prompter, host runner.Runner) ([]partition.Drive, error) {
+	disks, err := catalog.Disks(host)
+	if err != nil {
+		pr.printf("Could not list the disks: %s\n", err)
+	}
+	disks = slices.DeleteFunc(disks, func(disk catalog.Disk) bool {
+		return disk.ReadOnly
+	})
+
+	mode, err := firmware.Detect(host)
+	if err != nil {
+		pr.printf("Could not detect the firmware, UEFI is assumed: %s\n", err)
+		mode = firmware.Uefi
+	}
+	if mode == firmware.Bios {
+		pr.printf("The machine was booted with a BIOS: Grub needs a BIOS boot partition on the disk holding /boot\n")
+	}
+
+	var drives []partition.Drive
+	for {
+		d, err := askDrive(pr, disks, drives, mode)
+		if err != nil {
+			return nil, err
+		}
+		drives = append(drives, d)
+
+		another, err := pr.confirm("Set up another disk", false)
+		if err != nil {
+			return nil, err
+		}
+		if another {
+			continue
+		}
+
+		if err := partition.ValidateLayout(drives, nil, mode); err != nil {
+			pr.printf("  %s\n  Set up the disks again\n", err)
+			drives = nil
+			continue
+		}
+		return drives, nil
+	}
+}
+
+// Asks one disk and its partitions. The disks already set up
+// can't be chosen again.
+func askDrive(pr *prompter, disks []catalog.Disk, drives []partition.Drive, mode firmware.Mode) (partition.Drive, error) {
+	for {
+		var d partition.Drive
+		var err error
+
+		disk, err := askDisk(pr, disks)
+		if err != nil {
+			return d, err
+		}
+		d.Path = disk.Path
+		if slices.ContainsFunc(drives, func(other partition.Drive) bool { return other.Path == d.Path }) {
+			pr.printf("  %s is already set up\n", d.Path)
+			continue
+		}
+
+		if disk.PartitionTable == "gpt" {
+			if d.Append, err = pr.confirm("Keep the existing partitions and add the new ones after them", false); err != nil {
+				return d, err
+			}
+		} else {
+			pr.printf("%s doesn't have a GPT partition table, or it is unknown\n", d.Path)
+			if d.EraseAndCreateGpt, err = pr.confirm("Erase the whole disk and create a GPT partition table", false); err != nil {
+				return d, err
+			}
+			if !d.EraseAndCreateGpt {
+				pr.printf("  Choose another disk\n")
+				continue
+			}
+		}
+
+		recommended := "Recommended: EFI system partition, swap and root using the rest of the disk"
+		if mode == firmware.Bios {
+			recommended = "Recommended: BIOS boot partition, swap and root using the rest of the disk"
+		}
+		layout, err := pr.choose("Partition layout", []string{recommended, "Custom"}, 0)
+		if err != nil {
+			return d, err
+		}
+		if layout == 0 {
+			d.Partitions, err = askRecommendedPartitions(pr, mode)
+		} else {
+			d.Partitions, err = askPartitions(pr)
+		}
+		if err != nil {
+			return d, err
+		}
+
+		if err := d.Validate(); err != nil {
+			pr.printf("  %s\n  Set up the disk again\n", err)
+			continue
+		}
+		// The problems of the whole layout, e.g. no root partition, are
+		// only checked once every disk is set up
+		var report validation.Report
+		partition.CheckLayout("", append(slices.Clone(drives), d), nil, mode, &report)
+		report.Problems = slices.DeleteFunc(report.Problems, func(problem validation.Problem) bool {
+			return problem.Path == "drives"
+		})
+		if !report.Valid() {
+			pr.printf("  %s\n  Set up the disk again\n", report.Error())
+			continue
+		}
+
+		return d, nil
+	}
+}
+
+// Asks a disk among the listed disks when there are any, or its path.
+// The partition table of a disk given by its path is unknown.
+func askDisk(pr *prompter, disks []catalog.Disk) (catalog.Disk, error) {
+	askPath := func() (catalog.Disk, error) {
+		path, err := pr.askValid("Disk path", "", func(answer string) error {
+			if !strings.HasPrefix(answer, "/dev/") {
+				return errors.New("The path must start with /dev/")
+			}
+			return nil
+		})
+		return catalog.Disk{Path: path}, err
+	}
+
+	if len(disks) == 0 {
+		return askPath()
+	}
+
+	var options []string
+	for _, disk := range disks {
+		options = append(options, fmt.Sprintf("%-14s %10s  %-4s  %s", disk.Path, formatSize(disk.Size), disk.PartitionTable, disk.Model))
+	}
+	options = append(options, "Other disk")
+
+	i, err := pr.choose("Disk", options, 0)
+	if err != nil {
+		return catalog.Disk{}, err
+	}
+	if i == len(disks) {
+		return askPath()
+	}
+
+	return disks[i], nil
+}
+
+// Asks the swap size of the recommended layout and returns its
+// partitions: an EFI system partition (a BIOS boot partition on
+// BIOS), the swap and an ext4 root.
+func askRecommendedPartitions(pr *prompter, mode firmware.Mode) ([]partition.Partition, error) {
+	answer, err := pr.askValid("Swap size in GiB, 0 for none", "4", func(answer string) error {
+		if n, err := strconv.Atoi(answer); err != nil || n < 0 {
+			return errors.New("The size must be a positive number")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	swapSize, _ := strconv.Atoi(answer)
+	partitions := partition.RecommendedPartitions(swapSize, mode)
+
+	encrypt, err := pr.confirm("Encrypt the root partition", false)
+	if err != nil || !encrypt {
+		return partitions, err
+	}
+	passphrase, err := pr.askPassword("Encryption passphrase, asked at every boot")
+	if err != nil {
+		return nil, err
+	}
+	root := &partitions[len(partitions)-1]
+	root.Encryption = &partition.Encryption{Passphrase: passphrase}
+	if mode == firmware.Bios {
+		// /boot is on the root partition, Grub can only unlock LUKS1
+		root.Encryption.Version = "luks1"
+	}
+
+	return partitions, nil
+}
+
+// Asks the partitions of a custom layout, in order.
+func askPartitions(pr *prompter) ([]partition.Partition, error) {
+	var partitions []partition.Partition
+	for {
+		pr.printf("\nPartition %d\n", len(partitions)+1)
+		p, err := askPartition(pr)
+		if err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, p)
+
+		if p.Size.TakeRemaining {
+			return partitions, nil
+		}
+
+		another, err := pr.confirm("Add another partition", true)
+		if err != nil {
+			return nil, err
+		}
+		if !another {
+			return partitions, nil
+		}
+	}
+}
+
+// Asks the values of one partition until they are valid.
+func askPartition(pr *prompter) (partition.Partition, error) {
+	// The volume groups aren't set up by the wizard, so the
+	// Linux LVM partitions can't be used
+	types := slices.DeleteFunc(catalog.PartitionTypes(), func(t catalog.PartitionType) bool {
+		return (&partition.Partition{PartitionType: t.Guid}).IsLvm()
+	})
+	var typeOptions []string
+	for _, t := range types {
+		typeOptions = append(typeOptions, t.Name)
+	}
+
+	for {
+		var p partition.Partition
+
+		i, err := pr.choose("Partition type", typeOptions, 0)
+		if err != nil {
+			return p, err
+		}
+		p.PartitionType = types[i].Guid
+
+		answer, err := pr.askValid("Size, e.g. 512MiB, 1.5GiB, 25% of the disk or 50%FREE of the space left, \"rest\" for the rest of the disk", "rest", func(answer string) error {
+			size := parseSize(answer)
+			return size.Validate()
+		})
+		if err != nil {
+			return p, err
+		}
+		p.Size = parseSize(answer)
+
+		if p.NeedsFileSystem() {
+			fileSystems := partition.SupportedFileSystems()
+			i, err := pr.choose("File system", fileSystems, 0)
+			if err != nil {
+				return p, err
+			}
+			p.FileSystem = fileSystems[i]
+		}
+
+		if !p.IsSwap() && !p.IsBiosBoot() {
+			if p.MountPoint, err = pr.ask("Mount point", partition.DefaultMountPoint(p.PartitionType)); err != nil {
+				return p, err
+			}
+		}
+
+		if p.CanBeEncrypted() && (p.IsSwap() || p.MountPoint != "") {
+			encrypt, err := pr.confirm("Encrypt this partition", false)
+			if err != nil {
+				return p, err
+			}
+			if encrypt {
+				passphrase, err := pr.askPassword("Encryption passphrase, asked at every boot")
+				if err != nil {
+					return p, err
+				}
+				p.Encryption = &partition.Encryption{Passphrase: passphrase}
+			}
+		}
+
+		if err := p.Validate(); err != nil {
+			pr.printf("  %s\n  Set up the partition again\n", err)
+			continue
+		}
+
+		return p, nil
+	}
+}
+
+// Parses a size written as "rest", or as a PartitionSize value, e.g. "20GiB" or "25%".
+func parseSize(answer string) partition.PartitionSize {
+	if strings.EqualFold(answer, "rest") {
+		return partition.PartitionSize{TakeRemaining: true}
+	}
+
+	return partition.PartitionSize{Value: answer}
+}
+
+// Asks the mirror countries. None can be chosen to keep
+// the mirrorlist of the live system.
+func askMirrors(pr *prompter, host runner.Runner) ([]string, error) {
+	countries, err := mirrors.ListCountries(host)
+	if err != nil {
+		pr.printf("Could not list the mirror countries: %s\n", err)
+	}
+	for i, country := range countries {
+		pr.printf("  %2d) %s (%d servers)\n", i+1, country.Name, country.Servers)
+	}
+
+	var chosen []string
+	_, err = pr.askValid("Countries separated by commas (numbers or names), empty to keep the current mirrors", "", func(answer string) error {
+		chosen = nil
+		for _, field := range strings.Split(answer, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+
+			if n, err := strconv.Atoi(field); err == nil && n >= 1 && n <= len(countries) {
+				field = countries[n-1].Name
+			} else if err := mirrors.ValidateCountry(host, field); err != nil {
+				return fmt.Errorf("Unknown country: %s", field)
+			}
+			chosen = append(chosen, field)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chosen, nil
+}
+
+// Asks the timezone, by region when the timezones can be listed.
+func askTimezone(pr *prompter, host runner.Runner) (string, error) {
+	checkTimezone := func(answer string) error {
+		if err := timezone.ValidateTimezone(host, answer); err != nil {
+			return fmt.Errorf("Unknown timezone: %s", answer)
+		}
+		return nil
+	}
+
+	regions, err := catalog.Timezones(host)
+	if err != nil || len(regions) == 0 {
+		return pr.askValid("Timezone, e.g. America/Toronto", "UTC", checkTimezone)
+	}
+
+	var regionNames []string
+	for _, region := range regions {
+		regionNames = append(regionNames, region.Name)
+	}
+	i, err := pr.choose("Region", regionNames, 0)
+	if err != nil {
+		return "", err
+	}
+	region := regions[i]
+
+	i, err = pr.choose("Timezone", region.Timezones, 0)
+	if err != nil {
+		return "", err
+	}
+
+	return region.Timezones[i], nil
+}
+
+// Asks the locale. Answering "?" lists the available locales.
+func askLocale(pr *prompter, host runner.Runner) (string, error) {
+	for {
+		answer, err := pr.ask("Locale, \"?\" to list them", "en_US.UTF-8")
+		if err != nil {
+			return "", err
+		}
+
+		if answer == "?" {
+			locales, err := locale.ListLocales(host)
+			if err != nil {
+				pr.printf("  Could not list the locales: %s\n", err)
+			}
+			pr.printf("%s\n", strings.Join(locales, "  "))
+			continue
+		}
+
+		if err := locale.ValidateLocale(host, answer); err != nil {
+			pr.printf("  Unknown locale: %s\n", answer)
+			continue
+		}
+
+		return answer, nil
+	}
+}
+
+// Asks the users to create.
+func askUsers(pr *prompter) ([]user.User, error) {
+	users := []user.User{}
+	for {
+		another, err := pr.confirm("Create a user", len(users) == 0)
+		if err != nil {
+			return nil, err
+		}
+		if !another {
+			return users, nil
+		}
+
+		u, err := askUser(pr, users)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+}
+
+// Asks the values of one user until they are valid. The
+// usernames already used can't be chosen again.
+func askUser(pr *prompter, users []user.User) (user.User, error) {
+	for {
+		var u user.User
+		var err error
+
+		u.Username, err = pr.askValid("Username", "", func(answer string) error {
+			if slices.ContainsFunc(users, func(other user.User) bool { return other.Username == answer }) {
+				return fmt.Errorf("%s is already created", answer)
+			}
+			return nil
+		})
+		if err != nil {
+			return u, err
+		}
+		if u.Password, err = pr.askPassword("Password"); err != nil {
+			return u, err
+		}
+		if u.Homepath, err = pr.ask("Home directory", "/home/"+u.Username); err != nil {
+			return u, err
+		}
+		if u.Sudoer, err = pr.confirm("Allow the user to run commands as root with sudo", true); err != nil {
+			return u, err
+		}
+
+		if err := u.Validate(); err != nil {
+			pr.printf("  %s\n  Set up the user again\n", err)
+			continue
+		}
+
+		return u, nil
+	}
+}
+
+// Asks a file path and saves the payload inside it as JSON. The
+// file is only readable by its owner since it holds the passwords.
+//
+// Returns the exit status of the installer.
+func savePayload(pr *prompter, p *payload.Payload) int {
+	path, err := pr.ask("Payload file", defaultPayloadFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	content, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitInstallFailed
+	}
+
+	if err := os.WriteFile(path, append(content, '\n'), 0600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitInstallFailed
+	}
+
+	pr.printf("Payload saved to %s, install it with: %s %s\n", path, os.Args[0], path)
+	return exitSuccess
+}
+
+// Returns the size in bytes written with the largest
+// binary unit keeping it above 1, e.g. "238.5 GiB".
+func formatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
@@ -1,7 +1,265 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/october-os/october-installer/pkg/catalog"
+	"github.com/october-os/october-installer/pkg/events"
+	"github.com/october-os/october-installer/pkg/installer"
+	"github.com/october-os/october-installer/pkg/journal"
+	"github.com/october-os/october-installer/pkg/payload"
+	"github.com/october-os/october-installer/pkg/plan"
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/server"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+// Exit statuses of the installer.
+const (
+	exitSuccess        int = 0
+	exitInstallFailed  int = 1
+	exitUsage          int = 2
+	exitInvalidPayload int = 3
+)
+
+// Output formats of the plan.
+const (
+	formatText string = "text"
+	formatJson string = "json"
+)
 
 func main() {
-	fmt.Print("Hello, World!")
+	os.Exit(run())
+}
+
+// Parses the arguments, reads and validates the payload,
+// then runs the installation.
+//
+// Returns the exit status of the installer.
+func run() int {
+	validateOnly := flag.Bool("validate", false, "only validate the payload and print the JSON report on STDOUT")
+	planOnly := flag.Bool("plan", false, "print every action the install would do without touching the machine")
+	format := flag.String("format", formatText, "output format of the plan: text or json")
+	journalPath := flag.String("journal", journal.DefaultPath, "path of the journal recording each completed step, empty to disable it")
+	resume := flag.Bool("resume", false, "resume the installation recorded inside the journal from its first unfinished step")
+	noRollback := flag.Bool("no-rollback", false, "leave the mounts, swap and written files as they are when the installation fails")
+	restoreTables := flag.Bool("restore-partition-tables", false, "also restore the previous partition tables when rolling back")
+	eventsFd := flag.Int("events-fd", -1, "file descriptor receiving the progress events as JSON Lines, 1 for STDOUT, -1 to disable them")
+	interactive := flag.Bool("interactive", false, "ask every value of the payload on the terminal, then install it or save it")
+	catalogOnly := flag.Bool("catalog", false, "print the values a payload can be built from (disks, timezones...) as JSON on STDOUT")
+	serve := flag.String("serve", "", "serve the installer API on \"unix:<path>\" or a loopback \"<host>:<port>\" instead of installing a payload")
+	flag.Usage = usage
+	flag.Parse()
+
+	host := runner.Host{}
+
+	if flag.NArg() > 1 || (*format != formatText && *format != formatJson) || (*resume && *journalPath == "") {
+		usage()
+		return exitUsage
+	}
+
+	opts := installer.Options{
+		Journal:                *journalPath,
+		Resume:                 *resume,
+		Rollback:               !*noRollback,
+		RestorePartitionTables: *restoreTables,
+	}
+	if *eventsFd >= 0 {
+		eventsFile := os.NewFile(uintptr(*eventsFd), "events")
+		if eventsFile == nil {
+			fmt.Fprintf(os.Stderr, "Invalid events file descriptor: %d\n", *eventsFd)
+			return exitUsage
+		}
+		defer eventsFile.Close()
+		opts.Events = events.NewJSONLines(eventsFile)
+	}
+
+	if *interactive {
+		if flag.NArg() > 0 {
+			usage()
+			return exitUsage
+		}
+		return runInteractive(host, opts)
+	}
+
+	if *catalogOnly {
+		if flag.NArg() > 0 {
+			usage()
+			return exitUsage
+		}
+		return printCatalog(host)
+	}
+
+	if *serve != "" {
+		if flag.NArg() > 0 {
+			usage()
+			return exitUsage
+		}
+		return runServer(host, *serve, installer.Options{
+			Journal:  *journalPath,
+			Rollback: !*noRollback,
+		})
+	}
+
+	p, err := readPayload(flag.Arg(0))
+	if err != nil {
+		if *validateOnly {
+			report := &validation.Report{}
+			report.Add("", validation.CodeInvalidFormat, err.Error())
+			printReport(report)
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return exitInvalidPayload
+	}
+
+	report := p.Check(host)
+	if *validateOnly {
+		printReport(report)
+		if !report.Valid() {
+			return exitInvalidPayload
+		}
+		return exitSuccess
+	}
+	if !report.Valid() {
+		fmt.Fprintln(os.Stderr, report)
+		return exitInvalidPayload
+	}
+
+	if *planOnly {
+		installPlan, err := installer.Plan(host, p)
+		printPlan(installPlan, *format)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitInstallFailed
+		}
+		return exitSuccess
+	}
+
+	return install(host, p, opts)
+}
+
+// Installs the validated payload.
+//
+// Returns the exit status of the installer.
+func install(host runner.Runner, p *payload.Payload, opts installer.Options) int {
+	if os.Geteuid() != 0 {
+		fmt.Fprintln(os.Stderr, "The installer must be run as root")
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := installer.Install(ctx, host, p, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitInstallFailed
+	}
+
+	return exitSuccess
+}
+
+// Prints the catalog as JSON on STDOUT.
+//
+// Returns the exit status of the installer.
+func printCatalog(host runner.Runner) int {
+	c, err := catalog.Load(host)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitInstallFailed
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(c)
+	return exitSuccess
+}
+
+// Serves the installer API on the given address until
+// the installer gets interrupted.
+//
+// Returns the exit status of the installer.
+func runServer(host runner.Runner, address string, opts installer.Options) int {
+	if os.Geteuid() != 0 {
+		fmt.Fprintln(os.Stderr, "The installer must be run as root")
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := server.New(host, opts).ListenAndServe(ctx, address); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitInstallFailed
+	}
+
+	return exitSuccess
+}
+
+// Reads and decodes the payload from the file at the given path.
+// It is read from STDIN when the path is empty or "-".
+func readPayload(path string) (*payload.Payload, error) {
+	var r io.Reader = os.Stdin
+
+	if path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	return payload.Decode(r)
+}
+
+// Prints the plan on STDOUT in the given format.
+func printPlan(installPlan *plan.Plan, format string) {
+	if format == formatText {
+		fmt.Print(installPlan)
+		return
+	}
+
+	if installPlan.Actions == nil {
+		installPlan.Actions = []plan.Action{}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(installPlan)
+}
+
+// Prints the validation report as JSON on STDOUT.
+func printReport(report *validation.Report) {
+	if report.Problems == nil {
+		report.Problems = []validation.Problem{}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
+
+// Prints the usage of the installer on STDERR.
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] [payload.json]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s -serve <address> [flags]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s -interactive [flags]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s -catalog\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "Reads the JSON payload from the given file, or from STDIN when")
+	fmt.Fprintln(os.Stderr, "no file or \"-\" is given, then installs the described system.")
+	fmt.Fprintln(os.Stderr, "With -serve, the installer API is served instead (see doc/payload.md).")
+	fmt.Fprintln(os.Stderr, "\nExit statuses:")
+	fmt.Fprintln(os.Stderr, "  0  the installation succeeded")
+	fmt.Fprintln(os.Stderr, "  1  the installation (or its planning, or the catalog) failed")
+	fmt.Fprintln(os.Stderr, "  2  wrong usage")
+	fmt.Fprintln(os.Stderr, "  3  the payload could not be read or is invalid")
+	flag.PrintDefaults()
 }
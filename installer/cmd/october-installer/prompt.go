@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// errInputClosed is returned when STDIN is closed
+// before every question got answered.
+var errInputClosed = errors.New("input closed before the end of the questions")
+
+// prompter asks questions on a terminal.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// Returns a new prompter asking on STDOUT and reading the answers on STDIN.
+func newPrompter() *prompter {
+	return &prompter{
+		in:  bufio.NewReader(os.Stdin),
+		out: os.Stdout,
+	}
+}
+
+// Prints a formatted line.
+func (p *prompter) printf(format string, a ...any) {
+	fmt.Fprintf(p.out, format, a...)
+}
+
+// Reads one line without its line break.
+func (p *prompter) readLine() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return "", errInputClosed
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// Asks a question and returns the answer, or defaultValue
+// when the answer is empty.
+func (p *prompter) ask(question, defaultValue string) (string, error) {
+	if defaultValue != "" {
+		p.printf("%s [%s]: ", question, defaultValue)
+	} else {
+		p.printf("%s: ", question)
+	}
+
+	answer, err := p.readLine()
+	if err != nil {
+		return "", err
+	}
+	if answer == "" {
+		return defaultValue, nil
+	}
+
+	return answer, nil
+}
+
+// Asks a question until check accepts the answer.
+func (p *prompter) askValid(question, defaultValue string, check func(answer string) error) (string, error) {
+	for {
+		answer, err := p.ask(question, defaultValue)
+		if err != nil {
+			return "", err
+		}
+
+		if err := check(answer); err != nil {
+			p.printf("  %s\n", err)
+			continue
+		}
+
+		return answer, nil
+	}
+}
+
+// Asks a yes or no question.
+func (p *prompter) confirm(question string, defaultValue bool) (bool, error) {
+	choices := "y/N"
+	if defaultValue {
+		choices = "Y/n"
+	}
+
+	for {
+		p.printf("%s [%s]: ", question, choices)
+		answer, err := p.readLine()
+		if err != nil {
+			return false, err
+		}
+
+		switch strings.ToLower(answer) {
+		case "":
+			return defaultValue, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		p.printf("  Answer y or n\n")
+	}
+}
+
+// Lists the options and returns the index of the chosen one. The
+// option can be chosen by its number or by its exact text.
+func (p *prompter) choose(question string, options []string, defaultIndex int) (int, error) {
+	for i, option := range options {
+		p.printf("  %2d) %s\n", i+1, option)
+	}
+
+	for {
+		answer, err := p.ask(question, strconv.Itoa(defaultIndex+1))
+		if err != nil {
+			return 0, err
+		}
+
+		if i := slices.Index(options, answer); i >= 0 {
+			return i, nil
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+			return n - 1, nil
+		}
+		p.printf("  Choose a number between 1 and %d\n", len(options))
+	}
+}
+
+// Asks a non-empty password twice without echoing it.
+func (p *prompter) askPassword(question string) (string, error) {
+	for {
+		password, err := p.readHidden(question)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(password) == "" {
+			p.printf("  The password can't be empty\n")
+			continue
+		}
+
+		again, err := p.readHidden("Repeat the password")
+		if err != nil {
+			return "", err
+		}
+		if password != again {
+			p.printf("  The passwords don't match\n")
+			continue
+		}
+
+		return password, nil
+	}
+}
+
+// Reads one line without echoing it. The line is echoed when
+// STDIN isn't a terminal.
+func (p *prompter) readHidden(question string) (string, error) {
+	p.printf("%s: ", question)
+
+	if err := stty("-echo"); err == nil {
+		defer func() {
+			stty("echo")
+			p.printf("\n")
+		}()
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return "", errInputClosed
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Changes the settings of the terminal on STDIN.
+func stty(setting string) error {
+	cmd := exec.Command("stty", setting)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -1,8 +1,7 @@
 package arch_chroot
 
 import (
-	"io"
-	"os/exec"
+	"github.com/october-os/october-installer/pkg/runner"
 )
 
 // mountPoint is the mount point of the system to chroot into
@@ -15,21 +14,63 @@ const shell string = "/bin/bash"
 //
 // It executes: arch-chroot [mount_point] [shell] -c [command]
 //
-// It can return two types of errors:
-//   - PipeError: When it failed to pipe STDERR
+// It can return one type of error:
 //   - ArchChrootError: When the command ran with arch-chroot failed.
-func Run(command string) error {
-	cmd := exec.Command("arch-chroot", mountPoint, shell, "-c", command)
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return PipeError{Err: err}
-	}
+func Run(r runner.Runner, command string) error {
+	return RunWithInput(r, command, "")
+}
+
+// Executes the command in a shell using arch-chroot and feeds
+// input to it through STDIN.
+//
+// It executes: arch-chroot [mount_point] [shell] -c [command]
+//
+// It can return one type of error:
+//   - ArchChrootError: When the command ran with arch-chroot failed.
+func RunWithInput(r runner.Runner, command, input string) error {
+	cmd := runner.Command(shell, "-c", command)
+	cmd.Stdin = input
+
+	return run(r, cmd)
+}
 
-	err = cmd.Run()
+// Executes the program with its arguments using arch-chroot,
+// without going through a shell.
+//
+// It executes: arch-chroot [mount_point] [name] [args...]
+//
+// It can return one type of error:
+//   - ArchChrootError: When the command ran with arch-chroot failed.
+func Exec(r runner.Runner, name string, args ...string) error {
+	return run(r, runner.Command(name, args...))
+}
+
+// Executes the program with its arguments using arch-chroot,
+// without going through a shell, and feeds the secret to it through
+// STDIN, the secret being marked so that it never gets shown or
+// recorded.
+//
+// It executes: arch-chroot [mount_point] [name] [args...]
+//
+// It can return one type of error:
+//   - ArchChrootError: When the command ran with arch-chroot failed.
+func ExecWithSecret(r runner.Runner, secret, name string, args ...string) error {
+	cmd := runner.Command(name, args...)
+	cmd.Stdin = secret
+	cmd.Secret = true
+
+	return run(r, cmd)
+}
+
+// Executes the command using arch-chroot.
+//
+// It can return one type of error:
+//   - ArchChrootError: When the command ran with arch-chroot failed.
+func run(r runner.Runner, cmd runner.Cmd) error {
+	result, err := r.RunInChroot(mountPoint, cmd)
 	if err != nil {
-		stdErrOutput, _ := io.ReadAll(stderr)
 		return ArchChrootError{
-			StdErr: string(stdErrOutput),
+			StdErr: result.Stderr,
 			Err:    err,
 		}
 	}
@@ -21,22 +21,3 @@ func (e ArchChrootError) Error() string {
 func (e ArchChrootError) Unwrap() error {
 	return e.Err
 }
-
-// PipeError represents an error that occurred after
-// a failed attempt to pipe STDERR.
-//
-// It wraps the original error for better clarity.
-type PipeError struct {
-	Err error
-}
-
-// Returns a formatted error message including the original
-// error message.
-func (e PipeError) Error() string {
-	return fmt.Sprintf("STDERR pipe creation failed: error=%v", e.Err)
-}
-
-// Unwrap returns the underlying error for error chaining.
-func (e PipeError) Unwrap() error {
-	return e.Err
-}
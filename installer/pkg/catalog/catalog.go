@@ -0,0 +1,198 @@
+// Package catalog lists the values a payload can be built from,
+// so frontends can offer them instead of free text fields.
+package catalog
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/firmware"
+	"github.com/october-os/october-installer/pkg/locale"
+	"github.com/october-os/october-installer/pkg/mirrors"
+	"github.com/october-os/october-installer/pkg/partition"
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/timezone"
+)
+
+// Region used for the timezones without a region, e.g. "UTC".
+const regionOther string = "Other"
+
+// Catalog represents every value a payload can be built from.
+type Catalog struct {
+	// Firmware is the firmware the machine was booted with,
+	// deciding which partitions are needed to boot
+	Firmware        firmware.Mode     `json:"firmware"`
+	Disks           []Disk            `json:"disks"`
+	Timezones       []Region          `json:"timezones"`
+	Locales         []string          `json:"locales"`
+	MirrorCountries []mirrors.Country `json:"mirrorCountries"`
+	FileSystems     []string          `json:"fileSystems"`
+	PartitionTypes  []PartitionType   `json:"partitionTypes"`
+	PartitionTables []string          `json:"partitionTables"`
+	SizeUnits       []string          `json:"sizeUnits"`
+}
+
+// Disk represents a disk of the machine that partitions
+// can be created on.
+type Disk struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Model     string `json:"model"`
+	Transport string `json:"transport"`
+	Removable bool   `json:"removable"`
+	ReadOnly  bool   `json:"readOnly"`
+	// PartitionTable is "gpt", "dos" or empty when the disk has none
+	PartitionTable string `json:"partitionTable"`
+}
+
+// Region represents a region and its timezones, e.g.
+// "America" and "America/Toronto".
+type Region struct {
+	Name      string   `json:"name"`
+	Timezones []string `json:"timezones"`
+}
+
+// PartitionType represents a supported GPT partition type.
+type PartitionType struct {
+	Guid string `json:"guid"`
+	Name string `json:"name"`
+}
+
+// Returns the whole catalog.
+//
+// Can return error types:
+//   - CatalogError
+//   - firmware.FirmwareError
+//   - timezone.TimezoneError
+//   - locale.LocaleGenError
+//   - mirrors.MirrorListError
+func Load(r runner.Runner) (*Catalog, error) {
+	var c Catalog
+	var err error
+
+	if c.Firmware, err = firmware.Detect(r); err != nil {
+		return nil, err
+	}
+	if c.Disks, err = Disks(r); err != nil {
+		return nil, err
+	}
+	if c.Timezones, err = Timezones(r); err != nil {
+		return nil, err
+	}
+	if c.Locales, err = locale.ListLocales(r); err != nil {
+		return nil, err
+	}
+	if c.MirrorCountries, err = mirrors.ListCountries(r); err != nil {
+		return nil, err
+	}
+
+	c.FileSystems = partition.SupportedFileSystems()
+	c.PartitionTypes = PartitionTypes()
+	c.PartitionTables = partition.SupportedPartitionTables()
+	c.SizeUnits = partition.SupportedPartitionSizeUnits()
+
+	return &c, nil
+}
+
+// Returns the disks of the machine. Partitions, loop devices,
+// optical drives, compressed RAM disks and empty disks (e.g.
+// card readers without a card) aren't listed.
+//
+// It executes:
+//
+//	lsblk --json --bytes --nodeps --output PATH,SIZE,MODEL,TRAN,RM,RO,TYPE,PTTYPE
+//
+// Can return error types:
+//   - CatalogError
+func Disks(r runner.Runner) ([]Disk, error) {
+	result, err := r.Query(runner.Command("lsblk", "--json", "--bytes", "--nodeps", "--output", "PATH,SIZE,MODEL,TRAN,RM,RO,TYPE,PTTYPE"))
+	if err != nil {
+		return nil, CatalogError{
+			Err: err,
+		}
+	}
+
+	var output struct {
+		BlockDevices []struct {
+			Path   string `json:"path"`
+			Size   int64  `json:"size"`
+			Model  string `json:"model"`
+			Tran   string `json:"tran"`
+			Rm     bool   `json:"rm"`
+			Ro     bool   `json:"ro"`
+			Type   string `json:"type"`
+			PtType string `json:"pttype"`
+		} `json:"blockdevices"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &output); err != nil {
+		return nil, CatalogError{
+			Err: err,
+		}
+	}
+
+	disks := []Disk{}
+	for _, device := range output.BlockDevices {
+		if device.Type != "disk" || device.Size == 0 || strings.HasPrefix(device.Path, "/dev/zram") {
+			continue
+		}
+
+		disks = append(disks, Disk{
+			Path:           device.Path,
+			Size:           device.Size,
+			Model:          strings.TrimSpace(device.Model),
+			Transport:      device.Tran,
+			Removable:      device.Rm,
+			ReadOnly:       device.Ro,
+			PartitionTable: device.PtType,
+		})
+	}
+
+	return disks, nil
+}
+
+// Returns the available timezones grouped by region, in
+// alphabetical order. The timezones without a region are
+// grouped inside the "Other" region.
+//
+// Can return error types:
+//   - timezone.TimezoneError
+func Timezones(r runner.Runner) ([]Region, error) {
+	timezones, err := timezone.ListTimezones(r)
+	if err != nil {
+		return nil, err
+	}
+
+	regions := []Region{}
+	var other []string
+	for _, tz := range timezones {
+		name, _, found := strings.Cut(tz, "/")
+		if !found {
+			other = append(other, tz)
+			continue
+		}
+
+		if len(regions) == 0 || regions[len(regions)-1].Name != name {
+			regions = append(regions, Region{Name: name})
+		}
+		regions[len(regions)-1].Timezones = append(regions[len(regions)-1].Timezones, tz)
+	}
+
+	if len(other) > 0 {
+		regions = append(regions, Region{Name: regionOther, Timezones: other})
+	}
+
+	return regions, nil
+}
+
+// Returns the supported GPT partition types.
+func PartitionTypes() []PartitionType {
+	partitionTypes := []PartitionType{}
+	for _, guid := range partition.SupportedGptPartitionTypes() {
+		partitionTypes = append(partitionTypes, PartitionType{
+			Guid: guid,
+			Name: partition.GptPartitionTypeName(guid),
+		})
+	}
+
+	return partitionTypes
+}
@@ -0,0 +1,21 @@
+package catalog
+
+import "fmt"
+
+// CatalogError represents an error that occured
+// while listing the values of the catalog.
+type CatalogError struct {
+	Err error
+}
+
+// Error returns a formatted error message containing the
+// original error message inside.
+func (e CatalogError) Error() string {
+	return fmt.Sprintf("Catalog error: error=%s", e.Err.Error())
+}
+
+// Unwrap returns the original error wrapped inside
+// CatalogError.
+func (e CatalogError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,399 @@
+// Package cleanup provides the Tracker, a runner.Runner keeping
+// track of every side effect of an installation on the live system
+// so they can be undone in reverse order when the installation fails.
+//
+// Tracked side effects:
+//   - mount: undone with umount, forgotten once unmounted by the installer
+//   - swapon: undone with swapoff
+//   - cryptsetup open: undone with cryptsetup close
+//   - vgcreate and vgchange --activate y: undone with vgchange --activate n,
+//     so the encrypted physical volumes can be closed
+//   - written files: removed, or their previous content is restored
+//   - partition tables changed by sfdisk or erased by wipefs: restored
+//     from the 'sfdisk --dump' taken before the first change, when enabled.
+//     A drive whose partitions get deleted by 'sfdisk --delete' is also
+//     restored, but only until one of its partitions gets formatted
+//     (mkfs, mkswap, cryptsetup luksFormat, pvcreate or wipefs): the new
+//     partitions may then have overwritten the data of the deleted ones,
+//     which can't be brought back. Other signatures erased by wipefs, e.g. a file system written on
+//     the whole drive, can't be restored, and the file systems shrunk
+//     before their partition aren't grown back.
+//
+// Commands run inside the chroot and files written under /mnt aren't
+// tracked, they only change the new install which is unmounted during
+// the rollback.
+//
+// The files written by an installation step are tied to it: restoring
+// them undoes the step, which needs to run again when resuming.
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+// targetRoot is where the new install is mounted. The files written
+// under it aren't tracked.
+const targetRoot string = "/mnt"
+
+// Descriptions of the undo actions restoring the partition table of a
+// drive, followed by the drive.
+const (
+	restoreTableDescription string = "restore partition table of "
+	wipeTableDescription    string = "wipe partition table of "
+)
+
+// noPartitionTable is written by sfdisk on STDERR when the drive
+// doesn't have any partition table yet.
+const noPartitionTable string = "does not contain a recognized partition table"
+
+// undoAction represents how to undo one side effect.
+type undoAction struct {
+	description string
+	// step is the installation step undone by the action, only set
+	// for the written files
+	step string
+	run  func(r runner.Runner) error
+}
+
+// Tracker is a runner.Runner executing everything with the
+// wrapped Runner and remembering how to undo each side effect.
+type Tracker struct {
+	inner runner.Runner
+	// restoreTables enables the restoration of every partition table,
+	// not only of the ones partitions were deleted from
+	restoreTables bool
+	// dumpedDrives holds the drives whose partition table was dumped
+	dumpedDrives []string
+	// deletedFrom holds the drives whose partition table is restored only
+	// because partitions were deleted from it, until one gets formatted
+	deletedFrom []string
+	// step is the installation step the next side effects belong to
+	step    string
+	actions []undoAction
+}
+
+// Returns a new Tracker wrapping r. The partition tables changed by
+// sfdisk are only restored during the rollback if restoreTables is true,
+// or if partitions were deleted from them and none of their partitions
+// got formatted since.
+func NewTracker(r runner.Runner, restoreTables bool) *Tracker {
+	return &Tracker{
+		inner:         r,
+		restoreTables: restoreTables,
+	}
+}
+
+// Sets the installation step the next side effects belong to.
+func (t *Tracker) Step(name string) {
+	t.step = name
+}
+
+// Returns the installation steps undone by Rollback, whose written
+// files get restored or removed, in the order they were run.
+func (t *Tracker) UndoneSteps() []string {
+	var steps []string
+	for _, action := range t.actions {
+		if action.step != "" && !slices.Contains(steps, action.step) {
+			steps = append(steps, action.step)
+		}
+	}
+	return steps
+}
+
+// Returns the description of every side effect that would be undone
+// by Rollback, in the order they would be undone.
+func (t *Tracker) Pending() []string {
+	var descriptions []string
+	for _, action := range slices.Backward(t.actions) {
+		descriptions = append(descriptions, action.description)
+	}
+	return descriptions
+}
+
+// Undoes every tracked side effect in reverse order with the wrapped
+// Runner. Keeps going when an undo action fails.
+//
+// Can return error types:
+//   - RollbackError
+func (t *Tracker) Rollback() error {
+	var errs []error
+	for _, action := range slices.Backward(t.actions) {
+		if err := action.run(t.inner); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", action.description, err))
+		}
+	}
+	t.actions = nil
+	t.dumpedDrives = nil
+	t.deletedFrom = nil
+
+	if len(errs) > 0 {
+		return RollbackError{
+			Err: errors.Join(errs...),
+		}
+	}
+
+	return nil
+}
+
+// Forgets every tracked side effect, e.g. once the
+// installation succeeded.
+func (t *Tracker) Forget() {
+	t.actions = nil
+	t.dumpedDrives = nil
+	t.deletedFrom = nil
+}
+
+// Runs the command with the wrapped Runner and tracks its side effect.
+func (t *Tracker) Run(cmd runner.Cmd) (runner.Result, error) {
+	if (cmd.Name == "sfdisk" || cmd.Name == "wipefs") && (t.restoreTables || deletesPartitions(cmd)) {
+		if err := t.dumpPartitionTable(cmd); err != nil {
+			return runner.Result{}, err
+		}
+	}
+	if formats(cmd) {
+		t.forgetDeletedPartitions(cmd)
+	}
+
+	result, err := t.inner.Run(cmd)
+	if err != nil || len(cmd.Args) == 0 {
+		return result, err
+	}
+
+	target := cmd.Args[len(cmd.Args)-1]
+	switch cmd.Name {
+	case "mount":
+		t.track("unmount "+target, func(r runner.Runner) error {
+			_, err := r.Run(runner.Command("umount", target))
+			return err
+		})
+	case "umount":
+		// e.g. the top-level volume of a btrfs partition, only mounted
+		// while its subvolumes get created
+		t.forget("unmount " + target)
+	case "swapon":
+		t.track("disable swap "+target, func(r runner.Runner) error {
+			_, err := r.Run(runner.Command("swapoff", target))
+			return err
+		})
+	case "cryptsetup":
+		if cmd.Args[0] == "open" {
+			t.track("close encrypted device "+target, func(r runner.Runner) error {
+				_, err := r.Run(runner.Command("cryptsetup", "close", target))
+				return err
+			})
+		}
+	case "vgcreate", "vgchange":
+		if cmd.Name == "vgcreate" {
+			// vgcreate [options] <volume group> <physical volume>...
+			i := slices.IndexFunc(cmd.Args, func(arg string) bool { return !strings.HasPrefix(arg, "-") })
+			if i < 0 {
+				break
+			}
+			target = cmd.Args[i]
+		} else if !slices.Equal(cmd.Args[:len(cmd.Args)-1], []string{"--activate", "y"}) {
+			break
+		}
+		t.track("deactivate volume group "+target, func(r runner.Runner) error {
+			_, err := r.Run(runner.Command("vgchange", "--activate", "n", target))
+			return err
+		})
+	}
+
+	return result, nil
+}
+
+// Runs the read-only command with the wrapped Runner.
+func (t *Tracker) Query(cmd runner.Cmd) (runner.Result, error) {
+	return t.inner.Query(cmd)
+}
+
+// Runs the command inside the chroot with the wrapped Runner.
+func (t *Tracker) RunInChroot(root string, cmd runner.Cmd) (runner.Result, error) {
+	return t.inner.RunInChroot(root, cmd)
+}
+
+// Reads the file with the wrapped Runner.
+func (t *Tracker) ReadFile(path string) ([]byte, error) {
+	return t.inner.ReadFile(path)
+}
+
+// Writes the file with the wrapped Runner. The file is removed during
+// the rollback if it didn't exist, its previous content is restored
+// otherwise. The files of the new install, under /mnt, aren't tracked.
+func (t *Tracker) WriteFile(path string, data []byte) error {
+	if strings.HasPrefix(path, targetRoot+"/") {
+		return t.inner.WriteFile(path, data)
+	}
+
+	previous, readErr := t.inner.ReadFile(path)
+	if readErr != nil && !errors.Is(readErr, fs.ErrNotExist) {
+		return readErr
+	}
+
+	if err := t.inner.WriteFile(path, data); err != nil {
+		return err
+	}
+
+	undo := undoAction{
+		description: "restore file " + path,
+		step:        t.step,
+		run: func(r runner.Runner) error {
+			return r.WriteFile(path, previous)
+		},
+	}
+	if readErr != nil {
+		undo.description = "remove file " + path
+		undo.run = func(r runner.Runner) error {
+			_, err := r.Run(runner.Command("rm", "-f", path))
+			return err
+		}
+	}
+	t.actions = append(t.actions, undo)
+
+	return nil
+}
+
+// Adds an undo action.
+func (t *Tracker) track(description string, run func(r runner.Runner) error) {
+	t.actions = append(t.actions, undoAction{
+		description: description,
+		run:         run,
+	})
+}
+
+// Forgets the last tracked side effect with the given description,
+// once it got undone by the installer itself.
+func (t *Tracker) forget(description string) {
+	for i, action := range slices.Backward(t.actions) {
+		if action.description == description {
+			t.actions = slices.Delete(t.actions, i, i+1)
+			return
+		}
+	}
+}
+
+// Returns true if the rollback restores the partition table of at least one drive.
+func (t *Tracker) RestoresPartitionTables() bool {
+	return slices.ContainsFunc(t.actions, func(action undoAction) bool {
+		return strings.HasPrefix(action.description, restoreTableDescription) || strings.HasPrefix(action.description, wipeTableDescription)
+	})
+}
+
+// Stops restoring the partition tables of the drives whose partitions get
+// formatted by the command, when they are only restored because partitions
+// were deleted from them: the data of the deleted partitions may get
+// overwritten, restoring them would bring back partitions holding garbage.
+func (t *Tracker) forgetDeletedPartitions(cmd runner.Cmd) {
+	t.deletedFrom = slices.DeleteFunc(t.deletedFrom, func(drive string) bool {
+		if !slices.ContainsFunc(cmd.Args, func(arg string) bool { return isPartitionOf(arg, drive) }) {
+			return false
+		}
+		t.forget(restoreTableDescription + drive)
+		t.forget(wipeTableDescription + drive)
+		return true
+	})
+}
+
+// Dumps the partition table of the drive changed by the sfdisk or wipefs
+// command the first time the drive gets changed, and tracks its restoration.
+// A drive without any partition table gets its new one wiped instead.
+func (t *Tracker) dumpPartitionTable(cmd runner.Cmd) error {
+	if len(cmd.Args) == 0 || readOnly(cmd) {
+		return nil
+	}
+
+	drive := cmd.Args[len(cmd.Args)-1]
+	for _, arg := range cmd.Args {
+		if strings.HasPrefix(arg, "/dev/") {
+			drive = arg
+			break
+		}
+	}
+	if slices.Contains(t.dumpedDrives, drive) {
+		return nil
+	}
+
+	result, err := t.inner.Query(runner.Command("sfdisk", "--dump", drive))
+	if err != nil && !strings.Contains(result.Stderr, noPartitionTable) {
+		return fmt.Errorf("could not dump the partition table of drive '%s' before changing it: %w", drive, err)
+	}
+	t.dumpedDrives = append(t.dumpedDrives, drive)
+	if !t.restoreTables {
+		t.deletedFrom = append(t.deletedFrom, drive)
+	}
+
+	if err != nil {
+		t.track(wipeTableDescription+drive, func(r runner.Runner) error {
+			_, err := r.Run(runner.Command("wipefs", "--all", drive))
+			return err
+		})
+		return nil
+	}
+
+	dump := result.Stdout
+	t.track(restoreTableDescription+drive, func(r runner.Runner) error {
+		restore := runner.Command("sfdisk", drive)
+		restore.Stdin = dump
+		_, err := r.Run(restore)
+		return err
+	})
+
+	return nil
+}
+
+// Returns true if the command writes a file system or a header on the
+// partitions it is given, overwriting what they held.
+func formats(cmd runner.Cmd) bool {
+	switch {
+	case strings.HasPrefix(cmd.Name, "mkfs."), cmd.Name == "mkswap", cmd.Name == "pvcreate":
+		return true
+	case cmd.Name == "cryptsetup":
+		return len(cmd.Args) > 0 && cmd.Args[0] == "luksFormat"
+	case cmd.Name == "wipefs":
+		return !readOnly(cmd)
+	}
+	return false
+}
+
+// Returns true if node is a partition of the drive, e.g.
+// /dev/sda2 of /dev/sda or /dev/nvme0n1p2 of /dev/nvme0n1.
+func isPartitionOf(node, drive string) bool {
+	number, found := strings.CutPrefix(node, drive)
+	if !found {
+		return false
+	}
+	number = strings.TrimPrefix(number, "p")
+	return number != "" && strings.Trim(number, "0123456789") == ""
+}
+
+// Returns true if the sfdisk command deletes partitions.
+func deletesPartitions(cmd runner.Cmd) bool {
+	return cmd.Name == "sfdisk" && slices.Contains(cmd.Args, "--delete")
+}
+
+// Returns true if the sfdisk or wipefs command doesn't
+// change the partition table.
+func readOnly(cmd runner.Cmd) bool {
+	readOnlyArgs := []string{"--json", "-J", "--dump", "-d", "--list", "-l", "--list-free", "-F", "--show-size", "-s", "--verify", "-V"}
+	if cmd.Name == "wipefs" {
+		readOnlyArgs = []string{"--no-act", "-n"}
+		if !slices.Contains(cmd.Args, "--all") && !slices.Contains(cmd.Args, "-a") && !slices.ContainsFunc(cmd.Args, isWipefsOffset) {
+			return true
+		}
+	}
+
+	return slices.ContainsFunc(cmd.Args, func(arg string) bool {
+		return slices.Contains(readOnlyArgs, arg)
+	})
+}
+
+// Returns true if the wipefs argument selects a signature to erase.
+func isWipefsOffset(arg string) bool {
+	return arg == "--offset" || arg == "-o" || strings.HasPrefix(arg, "--offset=")
+}
@@ -0,0 +1,116 @@
+package cleanup
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+func TestTrackerRollback(t *testing.T) {
+	tests := []struct {
+		name          string
+		restoreTables bool
+		// install runs the side effects of the installation
+		install func(tr *Tracker)
+		// wantUndo are the calls made by the rollback, in order
+		wantUndo  []string
+		wantSteps []string
+	}{
+		{
+			name:          "reverse order",
+			restoreTables: true,
+			install: func(tr *Tracker) {
+				tr.Step("mirrors")
+				tr.WriteFile("/etc/pacman.d/mirrorlist", []byte("Server = https://mirrors.kernel.org/archlinux/$repo/os/$arch\n"))
+				tr.Step("partitions-created")
+				tr.Run(runner.Command("sfdisk", "/dev/sda"))
+				tr.Step("partitions-mounted")
+				tr.Run(runner.Command("cryptsetup", "open", "/dev/sda2", "root"))
+				tr.Run(runner.Command("mount", "/dev/mapper/root", "/mnt"))
+				tr.Run(runner.Command("mount", "/dev/sda1", "/mnt/boot"))
+				tr.Run(runner.Command("swapon", "/dev/sda3"))
+				tr.Step("fstab")
+				tr.WriteFile("/mnt/etc/fstab", []byte("/dev/sda1 /boot vfat defaults 0 2\n"))
+			},
+			wantUndo: []string{
+				"run: swapoff /dev/sda3",
+				"run: umount /mnt/boot",
+				"run: umount /mnt",
+				"run: cryptsetup close root",
+				"run: sfdisk /dev/sda",
+				"write: /etc/pacman.d/mirrorlist",
+			},
+			wantSteps: []string{"mirrors"},
+		},
+		{
+			name: "unmounted by the installer",
+			install: func(tr *Tracker) {
+				tr.Run(runner.Command("mount", "/dev/sda2", "/mnt"))
+				tr.Run(runner.Command("mount", "/dev/sda2", "/tmp/btrfs"))
+				tr.Run(runner.Command("umount", "/tmp/btrfs"))
+			},
+			wantUndo: []string{"run: umount /mnt"},
+		},
+		{
+			name: "partition table without deleted partitions",
+			install: func(tr *Tracker) {
+				tr.Run(runner.Command("sfdisk", "-a", "/dev/sda"))
+			},
+		},
+		{
+			name: "deleted partitions",
+			install: func(tr *Tracker) {
+				tr.Run(runner.Command("sfdisk", "--delete", "/dev/sda", "2"))
+				tr.Run(runner.Command("sfdisk", "-a", "/dev/sda"))
+				tr.Run(runner.Command("mkfs.ext4", "/dev/sdb1"))
+			},
+			wantUndo: []string{"run: sfdisk /dev/sda"},
+		},
+		{
+			name: "deleted partitions overwritten by a new partition",
+			install: func(tr *Tracker) {
+				tr.Run(runner.Command("sfdisk", "--delete", "/dev/sda", "2"))
+				tr.Run(runner.Command("sfdisk", "-a", "/dev/sda"))
+				tr.Run(runner.Command("mkfs.ext4", "/dev/sda2"))
+			},
+		},
+		{
+			name: "new file removed",
+			install: func(tr *Tracker) {
+				tr.Step("mirrors")
+				tr.WriteFile("/etc/october.conf", []byte("october\n"))
+			},
+			wantUndo:  []string{"run: rm -f /etc/october.conf"},
+			wantSteps: []string{"mirrors"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := runner.NewFake()
+			f.Files["/etc/pacman.d/mirrorlist"] = []byte("## Canada\n#Server = https://mirror.xenyth.net/archlinux/$repo/os/$arch\n")
+			f.OnOutput("sfdisk --dump /dev/sda", "label: gpt\n")
+
+			tr := NewTracker(f, test.restoreTables)
+			test.install(tr)
+			if got := tr.UndoneSteps(); !slices.Equal(got, test.wantSteps) {
+				t.Errorf("UndoneSteps() = %q, want %q", got, test.wantSteps)
+			}
+
+			installCalls := len(f.Calls)
+			if err := tr.Rollback(); err != nil {
+				t.Fatalf("Rollback() error = %v", err)
+			}
+			if got := f.Calls[installCalls:]; !slices.Equal(got, test.wantUndo) {
+				t.Errorf("rollback calls = %q, want %q", got, test.wantUndo)
+			}
+			if got := string(f.Files["/etc/pacman.d/mirrorlist"]); got != "## Canada\n#Server = https://mirror.xenyth.net/archlinux/$repo/os/$arch\n" {
+				t.Errorf("mirrorlist after Rollback() = %q", got)
+			}
+			if pending := tr.Pending(); len(pending) != 0 {
+				t.Errorf("Pending() after Rollback() = %q, want none", pending)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package cleanup
+
+import "fmt"
+
+// RollbackError represents an error that occured while undoing
+// the side effects of a failed installation.
+//
+// It wraps every error of the undo actions that failed.
+type RollbackError struct {
+	Err error
+}
+
+// Error returns a formatted error message containing the
+// original error messages.
+func (e RollbackError) Error() string {
+	return fmt.Sprintf("Rollback error: error=%s", e.Err.Error())
+}
+
+// Unwrap returns the original error wrapped inside
+// RollbackError.
+func (e RollbackError) Unwrap() error {
+	return e.Err
+}
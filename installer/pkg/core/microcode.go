@@ -1,9 +1,9 @@
 package core
 
 import (
-	"io"
-	"os/exec"
 	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
 )
 
 // vendor_id field values inside /proc/cpuinfo
@@ -20,29 +20,15 @@ const intelMicrocode string = "intel-ucode"
 // It gets the vendor id by executing:
 //
 //	cat /proc/cpuinfo | grep 'vendor_id'
-func getCpuMicroCode() (string, error) {
-	cmd := exec.Command("/bin/bash", "-c", "cat /proc/cpuinfo | grep 'vendor_id'")
-	stdoutPipe, err := cmd.StdoutPipe()
+func getCpuMicroCode(r runner.Runner) (string, error) {
+	result, err := r.Query(runner.Shell("cat /proc/cpuinfo | grep 'vendor_id'"))
 	if err != nil {
 		return "", err
 	}
 
-	if err := cmd.Start(); err != nil {
-		return "", err
-	}
-
-	stdoutBytes, err := io.ReadAll(stdoutPipe)
-	if err != nil {
-		return "", err
-	}
-
-	if err := cmd.Wait(); err != nil {
-		return "", err
-	}
-
-	if strings.Contains(string(stdoutBytes), amdId) {
+	if strings.Contains(result.Stdout, amdId) {
 		return amdMicrocode, nil
-	} else if strings.Contains(string(stdoutBytes), intelId) {
+	} else if strings.Contains(result.Stdout, intelId) {
 		return intelMicrocode, nil
 	}
 
@@ -2,7 +2,8 @@ package core
 
 import (
 	"errors"
-	"os/exec"
+
+	"github.com/october-os/october-installer/pkg/runner"
 )
 
 // Basic Arch Linux install packages names
@@ -10,14 +11,21 @@ const linuxKernel string = "linux"
 const baseArch string = "base"
 const baseLinuxFirmware string = "linux-firmware"
 
+// Packages needed by the other installation steps
+const sudo string = "sudo"
+const grub string = "grub"
+const efiBootManager string = "efibootmgr"
+const osProber string = "os-prober"
+
 // Installs a basic Arch Linux installation on the drive
 // mounted on /mnt using pacstrap. Detects and installs the CPU
-// microcode for the current CPU too.
+// microcode for the current CPU too, and the extra packages
+// needed by the other installation steps, e.g. lvm2.
 //
 // Can return errors of type:
 //   - CoreInstallError
-func InstallBasicInstallation() error {
-	cpuMicrocode, err := getCpuMicroCode()
+func InstallBasicInstallation(r runner.Runner, extraPackages ...string) error {
+	cpuMicrocode, err := getCpuMicroCode(r)
 	if err != nil {
 		return CoreInstallError{
 			Err: err,
@@ -28,9 +36,14 @@ func InstallBasicInstallation() error {
 		}
 	}
 
-	cmd := exec.Command("pacstrap", "-K", "/mnt", baseArch, linuxKernel, baseLinuxFirmware, cpuMicrocode)
+	args := []string{
+		"-K", "/mnt",
+		baseArch, linuxKernel, baseLinuxFirmware, cpuMicrocode,
+		sudo, grub, efiBootManager, osProber,
+	}
+	cmd := runner.Command("pacstrap", append(args, extraPackages...)...)
 
-	if err := cmd.Run(); err != nil {
+	if _, err := r.Run(cmd); err != nil {
 		return CoreInstallError{
 			Err: err,
 		}
@@ -0,0 +1,145 @@
+// Package events provides the progress events emitted during an
+// installation, so any frontend can render its progress live, and
+// the emitters writing them as JSON Lines.
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Types of event.
+const (
+	// TypeStepStarted is emitted when a step starts.
+	TypeStepStarted string = "step_started"
+	// TypeStepProgress is emitted when the progress of a step is known.
+	TypeStepProgress string = "step_progress"
+	// TypeOutput is emitted for every line written by a command.
+	TypeOutput string = "output"
+	// TypeWarning is emitted for a problem that doesn't stop the installation.
+	TypeWarning string = "warning"
+	// TypeStepFinished is emitted when a step succeeded, or was skipped.
+	TypeStepFinished string = "step_finished"
+	// TypeInstallFailed is emitted when the installation failed.
+	TypeInstallFailed string = "install_failed"
+	// TypeInstallFinished is emitted when the installation succeeded.
+	TypeInstallFinished string = "install_finished"
+)
+
+// Event represents something that happened during an installation.
+//
+// Only the fields making sense for its Type are set:
+//   - step_started: Step, Index and Total, Index starting at 1
+//   - step_progress: Step and Percent
+//   - output: Step, Command and Line
+//   - warning: Step (when known) and Message
+//   - step_finished: Step and Skipped
+//   - install_failed: Step and Message
+//   - install_finished: nothing more
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Step    string    `json:"step,omitempty"`
+	Index   int       `json:"index,omitempty"`
+	Total   int       `json:"total,omitempty"`
+	Percent *int      `json:"percent,omitempty"`
+	Command string    `json:"command,omitempty"`
+	Line    string    `json:"line,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Skipped bool      `json:"skipped,omitempty"`
+}
+
+// Returns a step_started event for the step at the given
+// index (starting at 1) out of total steps.
+func StepStarted(step string, index, total int) Event {
+	return Event{Type: TypeStepStarted, Time: time.Now(), Step: step, Index: index, Total: total}
+}
+
+// Returns a step_progress event.
+func StepProgress(step string, percent int) Event {
+	return Event{Type: TypeStepProgress, Time: time.Now(), Step: step, Percent: &percent}
+}
+
+// Returns an output event for a line written by the command.
+func Output(step, command, line string) Event {
+	return Event{Type: TypeOutput, Time: time.Now(), Step: step, Command: command, Line: line}
+}
+
+// Returns a warning event.
+func Warning(step, message string) Event {
+	return Event{Type: TypeWarning, Time: time.Now(), Step: step, Message: message}
+}
+
+// Returns a step_finished event.
+func StepFinished(step string, skipped bool) Event {
+	return Event{Type: TypeStepFinished, Time: time.Now(), Step: step, Skipped: skipped}
+}
+
+// Returns an install_failed event for the error of the step.
+func InstallFailed(step string, err error) Event {
+	return Event{Type: TypeInstallFailed, Time: time.Now(), Step: step, Message: err.Error()}
+}
+
+// Returns an install_finished event.
+func InstallFinished() Event {
+	return Event{Type: TypeInstallFinished, Time: time.Now()}
+}
+
+// Emitter receives the events of an installation.
+type Emitter interface {
+	Emit(e Event)
+}
+
+// Discard is an Emitter ignoring every event.
+type Discard struct{}
+
+// Ignores the event.
+func (Discard) Emit(e Event) {}
+
+// JSONLines is an Emitter writing each event as one line
+// of JSON. It can be used from multiple goroutines.
+type JSONLines struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// Returns a new JSONLines emitter writing to w.
+func NewJSONLines(w io.Writer) *JSONLines {
+	return &JSONLines{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Writes the event followed by a newline. Write
+// errors are ignored so the installation keeps going.
+func (j *JSONLines) Emit(e Event) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.encoder.Encode(e)
+}
+
+// pacmanProgress matches the "( 3/42) installing ..." lines of pacman.
+// Only the installing phase is used since it is the longest one.
+var pacmanProgress = regexp.MustCompile(`^\(\s*(\d+)/(\d+)\) installing `)
+
+// Returns the percentage of a pacman progress line,
+// ok is false if the line isn't one.
+func ParsePacmanProgress(line string) (percent int, ok bool) {
+	matches := pacmanProgress.FindStringSubmatch(line)
+	if matches == nil {
+		return 0, false
+	}
+
+	done, _ := strconv.Atoi(matches[1])
+	total, _ := strconv.Atoi(matches[2])
+	if total == 0 || done > total {
+		return 0, false
+	}
+
+	return done * 100 / total, true
+}
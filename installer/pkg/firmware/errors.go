@@ -0,0 +1,21 @@
+package firmware
+
+import "fmt"
+
+// FirmwareError represents an error that occured when
+// trying to detect the firmware of the machine.
+type FirmwareError struct {
+	Err error
+}
+
+// Error returns a formatted error message containing the
+// original error message inside.
+func (e FirmwareError) Error() string {
+	return fmt.Sprintf("Firmware detection error: error=%s", e.Err.Error())
+}
+
+// Unwrap returns the original error wrapped inside
+// FirmwareError.
+func (e FirmwareError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,43 @@
+// Package firmware detects whether the live system was booted
+// with UEFI or with a legacy BIOS, which decides how the disks
+// need to be partitioned and how Grub gets installed.
+package firmware
+
+import (
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+// Mode represents the firmware the machine was booted with.
+type Mode string
+
+// Firmware modes.
+const (
+	Uefi Mode = "uefi"
+	Bios Mode = "bios"
+)
+
+// efiDirectory only exists when the kernel was booted by UEFI.
+const efiDirectory string = "/sys/firmware/efi"
+
+// Returns the firmware the live system was booted with: UEFI
+// when /sys/firmware/efi exists, BIOS otherwise.
+//
+// It executes:
+//
+//	test -d /sys/firmware/efi
+//
+// Can return error types:
+//   - FirmwareError
+func Detect(r runner.Runner) (Mode, error) {
+	result, err := r.Query(runner.Command("test", "-d", efiDirectory))
+	if result.ExitCode == 1 { // not a directory
+		return Bios, nil
+	}
+	if err != nil {
+		return "", FirmwareError{
+			Err: err,
+		}
+	}
+
+	return Uefi, nil
+}
@@ -2,14 +2,20 @@ package grub
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/october-os/october-installer/pkg/arch_chroot"
+	"github.com/october-os/october-installer/pkg/runner"
 )
 
-const espMountPoint string = "/boot"
 const bootloaderId string = "GRUB"
 
-// Installs and sets up Grub on the newly installed system.
+// Configuration file of Grub inside the new install
+const defaultConfigFile string = "/etc/default/grub"
+
+// Installs and sets up Grub on the newly installed system,
+// the EFI system partition being mounted at espMountPoint
+// inside it.
 //
 // Does:
 //   - grub-Install
@@ -18,18 +24,41 @@ const bootloaderId string = "GRUB"
 //   - grub-mkconfig
 //
 // Can return error types:
-//   - PipeError
 //   - ArchChrootError
-func InstallGrub() error {
-	if err := grubInstall(); err != nil {
+func InstallGrub(r runner.Runner, espMountPoint string) error {
+	if err := grubInstall(r, espMountPoint); err != nil {
 		return err
 	}
 
-	if err := setUpOsProber(); err != nil {
+	if err := setUpOsProber(r); err != nil {
 		return err
 	}
 
-	return updateGrubConfig()
+	return updateGrubConfig(r)
+}
+
+// Installs and sets up Grub on the newly installed system
+// booted with a BIOS, Grub being installed inside the
+// boot sector of disk.
+//
+// Does:
+//   - grub-Install
+//   - uncommend os-prober line in /etc/default/grub
+//   - os-prober
+//   - grub-mkconfig
+//
+// Can return error types:
+//   - ArchChrootError
+func InstallGrubBios(r runner.Runner, disk string) error {
+	if err := grubInstallBios(r, disk); err != nil {
+		return err
+	}
+
+	if err := setUpOsProber(r); err != nil {
+		return err
+	}
+
+	return updateGrubConfig(r)
 }
 
 // Updates the current Grub config.
@@ -37,18 +66,18 @@ func InstallGrub() error {
 // Executes:
 //
 //	grub-mkconfig -o /boot/grub/grub.cfg
-func updateGrubConfig() error {
+func updateGrubConfig(r runner.Runner) error {
 	command := "grub-mkconfig -o /boot/grub/grub.cfg"
-	return arch_chroot.Run(command)
+	return arch_chroot.Run(r, command)
 }
 
 // Uncomments the os-prober line inside /etc/default/grub
 // and runs os-prober.
-func setUpOsProber() error {
+func setUpOsProber(r runner.Runner) error {
 	sedCommand := "sed -i 's/#GRUB_DISABLE_OS_PROBER=false/GRUB_DISABLE_OS_PROBER=false/' /etc/default/grub"
 	osProberCommand := "os-prober"
 	command := fmt.Sprintf("%s && %s", sedCommand, osProberCommand)
-	return arch_chroot.Run(command)
+	return arch_chroot.Run(r, command)
 }
 
 // Runs the Grub installation on the new system.
@@ -56,10 +85,54 @@ func setUpOsProber() error {
 // Executes:
 //
 //	grub-install...
-func grubInstall() error {
+func grubInstall(r runner.Runner, espMountPoint string) error {
 	command := fmt.Sprintf(
 		"grub-install --target=x86_64-efi --efi-directory=%s --bootloader-id=%s",
 		espMountPoint,
 		bootloaderId)
-	return arch_chroot.Run(command)
+	return arch_chroot.Run(r, command)
+}
+
+// Runs the Grub installation for BIOS on the new system.
+// On a GPT disk, Grub needs a BIOS boot partition.
+//
+// Executes:
+//
+//	grub-install --target=i386-pc <disk>
+func grubInstallBios(r runner.Runner, disk string) error {
+	command := fmt.Sprintf("grub-install --target=i386-pc %s", disk)
+	return arch_chroot.Run(r, command)
+}
+
+// Adds the kernel parameters to GRUB_CMDLINE_LINUX inside
+// /etc/default/grub, Grub needs to be configured again with
+// InstallGrub afterwards.
+//
+// Executes:
+//
+//	sed -i 's|^GRUB_CMDLINE_LINUX="|&<parameters> |' /etc/default/grub
+//
+// Can return error types:
+//   - ArchChrootError
+func AddKernelParameters(r runner.Runner, parameters ...string) error {
+	if len(parameters) == 0 {
+		return nil
+	}
+
+	command := fmt.Sprintf("sed -i 's|^GRUB_CMDLINE_LINUX=\"|&%s |' %s", strings.Join(parameters, " "), defaultConfigFile)
+	return arch_chroot.Run(r, command)
+}
+
+// Lets Grub unlock the encrypted partition holding /boot by
+// setting GRUB_ENABLE_CRYPTODISK inside /etc/default/grub.
+//
+// Executes:
+//
+//	sed -i 's/^#\?GRUB_ENABLE_CRYPTODISK=.*/GRUB_ENABLE_CRYPTODISK=y/' /etc/default/grub
+//
+// Can return error types:
+//   - ArchChrootError
+func EnableCryptodisk(r runner.Runner) error {
+	command := fmt.Sprintf("sed -i 's/^#\\?GRUB_ENABLE_CRYPTODISK=.*/GRUB_ENABLE_CRYPTODISK=y/' %s", defaultConfigFile)
+	return arch_chroot.Run(r, command)
 }
@@ -1,6 +1,13 @@
 package hostname
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidHostname is wrapped inside HostnameError when
+// the given hostname isn't a lowercase RFC 1123 label.
+var ErrInvalidHostname = errors.New("Invalid hostname. Must be 1 to 63 lowercase letters, digits or hyphens, not starting nor ending with a hyphen")
 
 // HostnameError represents an error that occured
 // when trying to set up the network hostname of the
@@ -1,58 +1,48 @@
 package hostname
 
 import (
-	"errors"
-	"fmt"
-	"unicode"
+	"regexp"
 
-	"github.com/october-os/october-installer/pkg/arch_chroot"
+	"github.com/october-os/october-installer/pkg/runner"
 )
 
+// hostnameFile is the file holding the hostname of the newly
+// installed system.
+const hostnameFile string = "/mnt/etc/hostname"
+
+// hostnameRegexp matches a single RFC 1123 label in lowercase:
+// 1 to 63 lowercase letters, digits or hyphens, not starting
+// nor ending with a hyphen.
+var hostnameRegexp *regexp.Regexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
 // Sets the network hostname for the newly
 // installed system. It sets it inside /etc/hostname.
 //
 // Can return errors of types:
-//   - PipeError
-//   - ArchChrootError
-func SetHostname(hostname string) error {
-	command := fmt.Sprintf("echo %s > /etc/hostname", hostname)
-	return arch_chroot.Run(command)
+//   - HostnameError
+func SetHostname(r runner.Runner, hostname string) error {
+	if err := r.WriteFile(hostnameFile, []byte(hostname+"\n")); err != nil {
+		return HostnameError{
+			Err: err,
+		}
+	}
+
+	return nil
 }
 
-// Checks if the given hostname is RFC1178 complient.
+// Checks if the given hostname is a valid RFC 1123 label
+// in lowercase.
 //
 // For more information: https://wiki.archlinux.org/title/Installation_guide#Network_configuration
 //
 // Can return errors of types:
 //   - HostnameError
 func ValidateHostname(hostname string) error {
-	var valid bool = true
-
-	if len(hostname) < 1 || len(hostname) > 63 {
-		valid = false
-	} else if hostname[0] == '-' {
-		valid = false
-	} else if !charCheck(hostname) {
-		valid = false
-	}
-
-	if !valid {
+	if !hostnameRegexp.MatchString(hostname) {
 		return HostnameError{
-			Err: errors.New("Invalid hostname. Must be RFC1178 complient"),
+			Err: ErrInvalidHostname,
 		}
 	}
 
 	return nil
 }
-
-// Checks if the given string is all lowercase and doesn't
-// contain any whitespaces.
-func charCheck(s string) bool {
-	for _, r := range s {
-		if !unicode.IsLower(r) && unicode.IsLetter(r) || r == ' ' {
-			return false
-		}
-	}
-
-	return true
-}
@@ -0,0 +1,56 @@
+package hostname
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+func TestValidateHostname(t *testing.T) {
+	tests := []struct {
+		hostname string
+		valid    bool
+	}{
+		{hostname: "october", valid: true},
+		{hostname: "october-2", valid: true},
+		{hostname: "7", valid: true},
+		{hostname: strings.Repeat("a", 63), valid: true},
+		{hostname: strings.Repeat("a", 64), valid: false},
+		{hostname: "", valid: false},
+		{hostname: "-october", valid: false},
+		{hostname: "october-", valid: false},
+		{hostname: "October", valid: false},
+		{hostname: "october.local", valid: false},
+		{hostname: "october; reboot", valid: false},
+		{hostname: "éte", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.hostname, func(t *testing.T) {
+			err := ValidateHostname(test.hostname)
+			if test.valid && err != nil {
+				t.Errorf("ValidateHostname(%q) error = %v, want nil", test.hostname, err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidHostname) {
+				t.Errorf("ValidateHostname(%q) error = %v, want %v", test.hostname, err, ErrInvalidHostname)
+			}
+		})
+	}
+}
+
+func TestSetHostname(t *testing.T) {
+	f := runner.NewFake()
+
+	if err := SetHostname(f, "october"); err != nil {
+		t.Fatalf("SetHostname() error = %v", err)
+	}
+	if want := []string{"write: " + hostnameFile}; !slices.Equal(f.Calls, want) {
+		t.Errorf("calls = %q, want %q", f.Calls, want)
+	}
+	if got := string(f.Files[hostnameFile]); got != "october\n" {
+		t.Errorf("%s = %q, want %q", hostnameFile, got, "october\n")
+	}
+}
@@ -0,0 +1,24 @@
+package installer
+
+import "fmt"
+
+// InstallError represents an error that occured during
+// one of the steps of the installation.
+//
+// It wraps the error returned by the step for better debugging.
+type InstallError struct {
+	Step string
+	Err  error
+}
+
+// Error returns a formatted error message containing the name
+// of the failed step and the original error message.
+func (e InstallError) Error() string {
+	return fmt.Sprintf("Install failed at step %q: error=%s", e.Step, e.Err.Error())
+}
+
+// Unwrap returns the original error wrapped inside
+// InstallError.
+func (e InstallError) Unwrap() error {
+	return e.Err
+}
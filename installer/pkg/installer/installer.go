@@ -0,0 +1,465 @@
+// Package installer glues every package together and runs
+// a whole installation from a validated payload.
+package installer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/october-os/october-installer/pkg/cleanup"
+	"github.com/october-os/october-installer/pkg/core"
+	"github.com/october-os/october-installer/pkg/events"
+	"github.com/october-os/october-installer/pkg/firmware"
+	"github.com/october-os/october-installer/pkg/grub"
+	"github.com/october-os/october-installer/pkg/hostname"
+	"github.com/october-os/october-installer/pkg/journal"
+	"github.com/october-os/october-installer/pkg/locale"
+	"github.com/october-os/october-installer/pkg/mirrors"
+	"github.com/october-os/october-installer/pkg/mkinitcpio"
+	"github.com/october-os/october-installer/pkg/partition"
+	"github.com/october-os/october-installer/pkg/payload"
+	"github.com/october-os/october-installer/pkg/plan"
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/timezone"
+	"github.com/october-os/october-installer/pkg/user"
+)
+
+// Names of the installation steps.
+const (
+	StepMirrors             string = "mirrors"
+	StepPartitionsCreated   string = "partitions-created"
+	StepPartitionsFormatted string = "partitions-formatted"
+	StepPartitionsMounted   string = "partitions-mounted"
+	StepBase                string = "base"
+	StepFstab               string = "fstab"
+	StepEncryption          string = "encryption"
+	StepInitramfs           string = "initramfs"
+	StepTimezone            string = "timezone"
+	StepLocale              string = "locale"
+	StepHostname            string = "hostname"
+	StepUsers               string = "users"
+	StepBootloader          string = "bootloader"
+	// StepRollback isn't an installation step, it is only used
+	// inside the events emitted during the rollback.
+	StepRollback string = "rollback"
+)
+
+// Options holds the optional features of an installation.
+type Options struct {
+	// Journal is the path of the journal recording each completed
+	// step. No journal is kept when empty.
+	Journal string
+	// Resume continues the installation recorded inside Journal from
+	// its first unfinished step instead of starting a new one.
+	Resume bool
+	// Rollback undoes the side effects on the live system (mounts,
+	// swap, written files) in reverse order when the installation fails
+	// or gets cancelled.
+	Rollback bool
+	// RestorePartitionTables also restores, during the rollback, the
+	// partition tables the drives had before the installation. The ones
+	// partitions were deleted from are always restored, as long as none
+	// of their partitions got formatted. The journal gets deleted since
+	// its layout doesn't exist anymore.
+	RestorePartitionTables bool
+	// Events receives the progress events of the installation.
+	// No event is emitted when nil.
+	Events events.Emitter
+}
+
+// installation holds the state shared by the steps
+// of an installation.
+type installation struct {
+	ctx     context.Context
+	runner  runner.Runner
+	events  events.Emitter
+	payload *payload.Payload
+	layout  partition.Layout
+	// step is the name of the running step
+	step string
+}
+
+// step represents one installation step.
+type step struct {
+	name string
+	run  func(in *installation) error
+}
+
+// steps lists every installation step in the order
+// they need to be executed.
+var steps []step = []step{
+	{StepMirrors, setMirrors},
+	{StepPartitionsCreated, createPartitions},
+	{StepPartitionsFormatted, formatPartitions},
+	{StepPartitionsMounted, mountPartitions},
+	{StepBase, installBase},
+	{StepFstab, writeFstab},
+	{StepEncryption, setUpEncryption},
+	{StepInitramfs, buildInitramfs},
+	{StepTimezone, setTimezone},
+	{StepLocale, setLocale},
+	{StepHostname, setHostname},
+	{StepUsers, setUsers},
+	{StepBootloader, installBootloader},
+}
+
+// Runs every installation step on the given payload. The payload
+// needs to be validated before calling Install.
+//
+// When a journal is used, each completed step is recorded inside it.
+// When resuming, the partitions of the journal layout are mounted
+// again if needed and the completed steps are skipped.
+//
+// Cancelling ctx stops the running command and fails the installation.
+// When rollback is enabled, the side effects are then undone and the
+// rollback errors are joined to the returned error.
+//
+// Can return error types:
+//   - InstallError
+//   - journal.JournalError
+//   - cleanup.RollbackError
+func Install(ctx context.Context, r runner.Runner, p *payload.Payload, opts Options) error {
+	var tracker *cleanup.Tracker
+	if opts.Rollback {
+		tracker = cleanup.NewTracker(r, opts.RestorePartitionTables)
+		r = tracker
+	}
+
+	in := &installation{
+		ctx:     ctx,
+		events:  opts.Events,
+		payload: p,
+	}
+	if in.events == nil {
+		in.events = events.Discard{}
+	}
+	in.runner = runner.WithContext(ctx, &outputRunner{
+		inner:  r,
+		events: in.events,
+		step:   func() string { return in.step },
+	})
+
+	var j *journal.Journal
+	var err error
+	if opts.Journal != "" {
+		j, err = openJournal(in, opts)
+	}
+	if err == nil {
+		onStep := func(name string) {}
+		if tracker != nil {
+			onStep = tracker.Step
+		}
+		err = in.runSteps(j, onStep)
+	}
+
+	if err == nil {
+		in.events.Emit(events.InstallFinished())
+		return nil
+	}
+
+	if tracker != nil {
+		err = in.rollback(tracker, j, opts.RestorePartitionTables, err)
+	}
+	in.events.Emit(events.InstallFailed(in.step, err))
+
+	return err
+}
+
+// Plans the installation of the given payload without touching
+// the machine: every step runs against a plan.Recorder, which only
+// uses r for read-only queries. The payload needs to be validated
+// before calling Plan.
+//
+// Returns the plan recorded until the failing step on error.
+//
+// Can return error types:
+//   - InstallError
+func Plan(r runner.Runner, p *payload.Payload) (*plan.Plan, error) {
+	recorder := plan.NewRecorder(r)
+	in := &installation{
+		ctx:     context.Background(),
+		runner:  recorder,
+		events:  events.Discard{},
+		payload: p,
+	}
+
+	err := in.runSteps(nil, recorder.Step)
+	return recorder.Plan(), err
+}
+
+// Creates a new journal, or loads the existing one when resuming.
+// When resuming after the partitions got mounted, the partitions
+// that aren't mounted anymore are mounted again.
+func openJournal(in *installation, opts Options) (*journal.Journal, error) {
+	if !opts.Resume {
+		return journal.Create(opts.Journal, in.payload.Digest())
+	}
+
+	j, err := journal.Load(opts.Journal)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.CheckPayload(in.payload.Digest()); err != nil {
+		return nil, err
+	}
+
+	// The passphrases aren't saved inside the journal
+	in.layout = j.Layout
+	in.layout.RestorePassphrases(in.payload.Drives)
+	if j.Done(StepPartitionsMounted) {
+		in.step = StepPartitionsMounted
+		if err := partition.RemountPartitions(in.runner, in.layout); err != nil {
+			return nil, InstallError{
+				Step: StepPartitionsMounted,
+				Err:  fmt.Errorf("could not mount the journal layout again: %w", err),
+			}
+		}
+	}
+
+	return j, nil
+}
+
+// Runs every step in order, calling onStep with the name of
+// each step before running it. Steps already completed inside
+// the journal are skipped, j can be nil.
+func (in *installation) runSteps(j *journal.Journal, onStep func(name string)) error {
+	for i, s := range steps {
+		in.step = s.name
+		if j != nil && j.Done(s.name) {
+			in.events.Emit(events.StepFinished(s.name, true))
+			continue
+		}
+		if err := in.ctx.Err(); err != nil {
+			return InstallError{
+				Step: s.name,
+				Err:  err,
+			}
+		}
+
+		onStep(s.name)
+		in.events.Emit(events.StepStarted(s.name, i+1, len(steps)))
+		if err := s.run(in); err != nil {
+			return InstallError{
+				Step: s.name,
+				Err:  err,
+			}
+		}
+
+		if j != nil {
+			if s.name == StepPartitionsCreated {
+				if err := j.SetLayout(in.layout.WithoutPassphrases()); err != nil {
+					return err
+				}
+			}
+			if err := j.Complete(s.name); err != nil {
+				return err
+			}
+		}
+		in.events.Emit(events.StepFinished(s.name, false))
+	}
+
+	return nil
+}
+
+// Undoes the side effects tracked during the failed installation
+// and returns installErr joined with the rollback errors. The
+// journal gets deleted once the partition tables are restored,
+// otherwise the steps whose files got restored are marked as not
+// completed so resuming runs them again.
+func (in *installation) rollback(tracker *cleanup.Tracker, j *journal.Journal, restoreTables bool, installErr error) error {
+	failedStep := in.step
+	in.step = StepRollback
+	in.events.Emit(events.StepStarted(StepRollback, 1, 1))
+
+	// Both are computed before the tracked side effects are forgotten
+	restoresTables := restoreTables || tracker.RestoresPartitionTables()
+	undoneSteps := tracker.UndoneSteps()
+
+	if err := tracker.Rollback(); err != nil {
+		in.events.Emit(events.Warning(StepRollback, err.Error()))
+		installErr = errors.Join(installErr, err)
+	} else if restoresTables && j != nil {
+		if err := j.Delete(); err != nil {
+			in.events.Emit(events.Warning(StepRollback, err.Error()))
+			installErr = errors.Join(installErr, err)
+		}
+		j = nil
+	}
+
+	if j != nil && len(undoneSteps) > 0 {
+		if err := j.Uncomplete(undoneSteps...); err != nil {
+			in.events.Emit(events.Warning(StepRollback, err.Error()))
+			installErr = errors.Join(installErr, err)
+		}
+	}
+
+	in.events.Emit(events.StepFinished(StepRollback, false))
+	in.step = failedStep
+	return installErr
+}
+
+// Keeps only the servers of the chosen countries in the live
+// system mirrorlist. pacstrap copies it into the new install.
+// The mirrorlist is left untouched when no country is given.
+func setMirrors(in *installation) error {
+	if len(in.payload.Mirrors) == 0 {
+		in.events.Emit(events.Warning(in.step, "No mirror country given, the mirrorlist of the live system is used as is"))
+		return nil
+	}
+
+	return mirrors.SetMirrorList(in.runner, in.payload.Mirrors)
+}
+
+// Creates the partitions of every drive, the logical volumes of
+// the volume groups being added to the layout.
+func createPartitions(in *installation) error {
+	layout, err := partition.CreatePartitions(in.runner, in.payload.Drives)
+	if err != nil {
+		return err
+	}
+	layout, err = partition.MapVolumeGroups(layout, in.payload.VolumeGroups)
+	if err != nil {
+		return err
+	}
+
+	in.layout = layout
+	return nil
+}
+
+// Creates the volume groups, then formats the created partitions
+// and logical volumes.
+func formatPartitions(in *installation) error {
+	return partition.FormatPartitions(in.runner, in.layout)
+}
+
+// Mounts the created partitions.
+func mountPartitions(in *installation) error {
+	return partition.MountPartitions(in.runner, in.layout)
+}
+
+// Installs the base system on the mounted partitions, with the
+// packages needed by the layout, e.g. lvm2.
+func installBase(in *installation) error {
+	return core.InstallBasicInstallation(in.runner, in.layout.Packages()...)
+}
+
+// Writes the fstab of the new install.
+func writeFstab(in *installation) error {
+	return partition.WriteFstab(in.runner, in.layout)
+}
+
+// Unlocks the encrypted partitions at boot: writes the crypttab
+// and adds the kernel parameters unlocking the root partition.
+// Grub unlocks the partition holding /boot when it is encrypted.
+// Does nothing when no partition is encrypted.
+func setUpEncryption(in *installation) error {
+	if !in.layout.Encrypted() {
+		return nil
+	}
+
+	if err := partition.WriteCrypttab(in.runner, in.layout); err != nil {
+		return err
+	}
+
+	parameters, err := partition.KernelParameters(in.runner, in.layout)
+	if err != nil {
+		return err
+	}
+	if err := grub.AddKernelParameters(in.runner, parameters...); err != nil {
+		return err
+	}
+
+	if in.layout.BootEncrypted() {
+		return grub.EnableCryptodisk(in.runner)
+	}
+	return nil
+}
+
+// Builds the initramfs with the hooks needed to mount / at boot:
+// sd-encrypt unlocks the encrypted partitions, then lvm2 activates
+// the volume groups. Does nothing when neither is needed, pacstrap
+// already built it.
+func buildInitramfs(in *installation) error {
+	var hooks []string
+	if in.layout.Encrypted() {
+		hooks = append(hooks, "sd-encrypt")
+	}
+	if in.layout.HasVolumeGroups() {
+		hooks = append(hooks, "lvm2")
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	return mkinitcpio.Configure(in.runner, hooks...)
+}
+
+// Sets the timezone and the hardware clock.
+func setTimezone(in *installation) error {
+	if err := timezone.SetTime(in.runner, in.payload.Timezone); err != nil {
+		return err
+	}
+
+	return timezone.SetHwClock(in.runner)
+}
+
+// Generates the locales.
+func setLocale(in *installation) error {
+	return locale.GenerateLocales(in.runner, in.payload.Locale)
+}
+
+// Sets the network hostname.
+func setHostname(in *installation) error {
+	return hostname.SetHostname(in.runner, in.payload.Hostname)
+}
+
+// Sets the root password, then creates every user. The sudoers
+// file is only set up if at least one user is a sudoer.
+func setUsers(in *installation) error {
+	r := in.runner
+	p := in.payload
+
+	if err := user.SetRootPassword(r, p.RootPassword); err != nil {
+		return err
+	}
+
+	if p.HasSudoer() {
+		if err := user.SetupSudoerFile(r); err != nil {
+			return err
+		}
+	}
+
+	for i := range p.Users {
+		if err := user.CreateUser(r, &p.Users[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Installs and configures Grub on the EFI system partition, or
+// on the drive holding /boot when the machine was booted with
+// a BIOS.
+func installBootloader(in *installation) error {
+	mode, err := firmware.Detect(in.runner)
+	if err != nil {
+		return err
+	}
+
+	if mode == firmware.Bios {
+		bootDrive := in.layout.BootDrive()
+		if bootDrive == "" {
+			return errors.New("the drive holding /boot isn't known")
+		}
+		return grub.InstallGrubBios(in.runner, bootDrive)
+	}
+
+	espMountPoint := in.layout.EfiMountPoint()
+	if espMountPoint == "" {
+		return errors.New("no EFI system partition is mounted")
+	}
+
+	return grub.InstallGrub(in.runner, espMountPoint)
+}
@@ -0,0 +1,157 @@
+package installer
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/october-os/october-installer/pkg/journal"
+	"github.com/october-os/october-installer/pkg/partition"
+	"github.com/october-os/october-installer/pkg/payload"
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/user"
+)
+
+// mirrorlist is the live mirrorlist before the installation.
+const mirrorlist string = "## Canada\n#Server = https://mirror.xenyth.net/archlinux/$repo/os/$arch\n"
+
+// Returns the payload of the resumed installations.
+func testPayload() *payload.Payload {
+	return &payload.Payload{
+		Drives: []partition.Drive{
+			{Path: "/dev/sda", Partitions: []partition.Partition{{FileSystem: "ext4", PartitionType: "4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709", MountPoint: "/"}}},
+		},
+		Users:        []user.User{{Username: "alice", Password: "secret", Homepath: "/home/alice"}},
+		Mirrors:      []string{"Canada"},
+		Timezone:     "America/Toronto",
+		Locale:       "en_CA.UTF-8",
+		Hostname:     "october",
+		RootPassword: "hunter2",
+	}
+}
+
+// Creates a journal for p at path with every step completed but the given ones.
+func createJournal(t *testing.T, path string, p *payload.Payload, unfinished ...string) {
+	t.Helper()
+
+	j, err := journal.Create(path, p.Digest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := partition.Layout{{Partition: p.Drives[0].Partitions[0], Node: "/dev/sda2", Drive: "/dev/sda"}}
+	if err := j.SetLayout(layout); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range steps {
+		if slices.Contains(unfinished, s.name) {
+			continue
+		}
+		if err := j.Complete(s.name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInstallResume(t *testing.T) {
+	p := testPayload()
+	path := filepath.Join(t.TempDir(), journal.DefaultPath)
+	createJournal(t, path, p, StepHostname)
+
+	f := runner.NewFake()
+	err := Install(context.Background(), f, p, Options{Journal: path, Resume: true, Rollback: true})
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	// The partitions are already mounted, only the hostname is set
+	wantCalls := []string{
+		"query: findmnt --noheadings --source /dev/sda2 --mountpoint /mnt",
+		"write: /mnt/etc/hostname",
+	}
+	if !slices.Equal(f.Calls, wantCalls) {
+		t.Errorf("calls = %q, want %q", f.Calls, wantCalls)
+	}
+
+	j, err := journal.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !j.Done(StepHostname) {
+		t.Errorf("step %q not completed inside the journal", StepHostname)
+	}
+}
+
+func TestInstallResumeOtherPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(p *payload.Payload)
+		wantErr bool
+	}{
+		{
+			name:    "other hostname",
+			change:  func(p *payload.Payload) { p.Hostname = "november" },
+			wantErr: true,
+		},
+		{
+			name: "other passwords",
+			change: func(p *payload.Payload) {
+				p.RootPassword = "correct horse"
+				p.Users[0].Password = "battery staple"
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := testPayload()
+			path := filepath.Join(t.TempDir(), journal.DefaultPath)
+			createJournal(t, path, p)
+
+			test.change(p)
+			f := runner.NewFake()
+			err := Install(context.Background(), f, p, Options{Journal: path, Resume: true, Rollback: true})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Install() error = %v, want error %t", err, test.wantErr)
+			}
+			if test.wantErr && !errors.As(err, &journal.JournalError{}) {
+				t.Errorf("Install() error = %T, want journal.JournalError", err)
+			}
+			if test.wantErr && len(f.Calls) != 0 {
+				t.Errorf("calls = %q, want none", f.Calls)
+			}
+		})
+	}
+}
+
+func TestInstallRollbackUncompletesSteps(t *testing.T) {
+	p := testPayload()
+	path := filepath.Join(t.TempDir(), journal.DefaultPath)
+	createJournal(t, path, p, StepMirrors, StepUsers)
+
+	f := runner.NewFake()
+	f.Files["/etc/pacman.d/mirrorlist"] = []byte(mirrorlist)
+	f.On("chroot: passwd -s", runner.Result{ExitCode: 1, Stderr: "failed"})
+
+	err := Install(context.Background(), f, p, Options{Journal: path, Resume: true, Rollback: true})
+	if !errors.As(err, &InstallError{}) {
+		t.Fatalf("Install() error = %v, want InstallError", err)
+	}
+
+	if got := string(f.Files["/etc/pacman.d/mirrorlist"]); got != mirrorlist {
+		t.Errorf("mirrorlist after the rollback = %q, want %q", got, mirrorlist)
+	}
+	j, err := journal.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []string{StepMirrors, StepUsers} {
+		if j.Done(step) {
+			t.Errorf("step %q completed inside the journal after the rollback", step)
+		}
+	}
+	if !j.Done(StepHostname) {
+		t.Errorf("step %q not completed inside the journal after the rollback", StepHostname)
+	}
+}
@@ -0,0 +1,66 @@
+package installer
+
+import (
+	"github.com/october-os/october-installer/pkg/events"
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+// outputRunner is a Runner emitting an output event for every
+// line written by the commands changing the machine, and a
+// step_progress event when pacman reports its progress.
+type outputRunner struct {
+	inner  runner.Runner
+	events events.Emitter
+	// step returns the name of the running step
+	step func() string
+}
+
+// Runs the command with the wrapped Runner, emitting its output.
+func (o *outputRunner) Run(cmd runner.Cmd) (runner.Result, error) {
+	return o.inner.Run(o.withOutput(cmd))
+}
+
+// Runs the read-only command with the wrapped Runner. Its output
+// is data read by the installer so it isn't emitted.
+func (o *outputRunner) Query(cmd runner.Cmd) (runner.Result, error) {
+	return o.inner.Query(cmd)
+}
+
+// Runs the command inside the chroot with the wrapped Runner,
+// emitting its output.
+func (o *outputRunner) RunInChroot(root string, cmd runner.Cmd) (runner.Result, error) {
+	return o.inner.RunInChroot(root, o.withOutput(cmd))
+}
+
+// Reads the file with the wrapped Runner.
+func (o *outputRunner) ReadFile(path string) ([]byte, error) {
+	return o.inner.ReadFile(path)
+}
+
+// Writes the file with the wrapped Runner.
+func (o *outputRunner) WriteFile(path string, data []byte) error {
+	return o.inner.WriteFile(path, data)
+}
+
+// Returns the command with an OnOutput callback emitting the events,
+// calling the previous callback too.
+func (o *outputRunner) withOutput(cmd runner.Cmd) runner.Cmd {
+	step := o.step()
+	command := cmd.String()
+	previous := cmd.OnOutput
+	lastPercent := -1
+
+	cmd.OnOutput = func(line string) {
+		if previous != nil {
+			previous(line)
+		}
+
+		o.events.Emit(events.Output(step, command, line))
+		if percent, ok := events.ParsePacmanProgress(line); ok && percent != lastPercent {
+			lastPercent = percent
+			o.events.Emit(events.StepProgress(step, percent))
+		}
+	}
+
+	return cmd
+}
@@ -0,0 +1,22 @@
+package journal
+
+import "fmt"
+
+// JournalError represents an error that occured while
+// reading or saving the journal file.
+type JournalError struct {
+	Path string
+	Err  error
+}
+
+// Error returns a formatted error message containing the
+// journal path and the original error message.
+func (e JournalError) Error() string {
+	return fmt.Sprintf("Journal error: path=%s, error=%s", e.Path, e.Err.Error())
+}
+
+// Unwrap returns the original error wrapped inside
+// JournalError.
+func (e JournalError) Unwrap() error {
+	return e.Err
+}
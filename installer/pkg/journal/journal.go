@@ -0,0 +1,200 @@
+// Package journal provides the checkpoint journal of an installation.
+//
+// The journal is a JSON file saved after every completed step. It
+// holds the names of the completed steps, the partition layout once
+// the partitions are created and a digest of the payload, so an
+// interrupted installation of the same payload can be resumed from
+// its first unfinished step.
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/october-os/october-installer/pkg/partition"
+)
+
+// DefaultPath is the path of the journal file when none is given.
+const DefaultPath string = "october-installer-journal.json"
+
+// Journal represents the progress of an installation.
+type Journal struct {
+	path string
+
+	PayloadDigest string           `json:"payloadDigest"`
+	Completed     []string         `json:"completed"`
+	Layout        partition.Layout `json:"layout,omitempty"`
+}
+
+// Creates a new empty journal at path for the payload with the
+// given digest. An existing journal at path is overwritten.
+//
+// Can return error types:
+//   - JournalError
+func Create(path, payloadDigest string) (*Journal, error) {
+	j := &Journal{
+		path:          path,
+		PayloadDigest: payloadDigest,
+		Completed:     []string{},
+	}
+
+	if err := j.save(); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Loads the journal saved at path.
+//
+// Can return error types:
+//   - JournalError
+func Load(path string) (*Journal, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, JournalError{
+			Path: path,
+			Err:  err,
+		}
+	}
+
+	j := &Journal{path: path}
+	if err := json.Unmarshal(content, j); err != nil {
+		return nil, JournalError{
+			Path: path,
+			Err:  err,
+		}
+	}
+
+	return j, nil
+}
+
+// Returns the path of the journal file.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Returns true if the step was completed.
+func (j *Journal) Done(step string) bool {
+	return slices.Contains(j.Completed, step)
+}
+
+// Marks the step as completed and saves the journal.
+//
+// Can return error types:
+//   - JournalError
+func (j *Journal) Complete(step string) error {
+	if !j.Done(step) {
+		j.Completed = append(j.Completed, step)
+	}
+
+	return j.save()
+}
+
+// Marks the steps as not completed and saves the journal, e.g.
+// once the rollback undid them.
+//
+// Can return error types:
+//   - JournalError
+func (j *Journal) Uncomplete(steps ...string) error {
+	j.Completed = slices.DeleteFunc(j.Completed, func(step string) bool {
+		return slices.Contains(steps, step)
+	})
+
+	return j.save()
+}
+
+// Saves the layout of the created partitions inside the journal.
+//
+// Can return error types:
+//   - JournalError
+func (j *Journal) SetLayout(layout partition.Layout) error {
+	j.Layout = layout
+	return j.save()
+}
+
+// Checks that the journal was created for the payload
+// with the given digest.
+//
+// Can return error types:
+//   - JournalError
+func (j *Journal) CheckPayload(payloadDigest string) error {
+	if j.PayloadDigest != payloadDigest {
+		return JournalError{
+			Path: j.path,
+			Err:  errors.New("the journal was created for another payload"),
+		}
+	}
+
+	return nil
+}
+
+// Deletes the journal file, e.g. once the layout it holds
+// doesn't exist anymore.
+//
+// Can return error types:
+//   - JournalError
+func (j *Journal) Delete() error {
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return JournalError{
+			Path: j.path,
+			Err:  err,
+		}
+	}
+
+	return nil
+}
+
+// Writes the journal to a temporary file then renames it,
+// so a crash never leaves a half-written journal behind.
+func (j *Journal) save() error {
+	content, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return JournalError{
+			Path: j.path,
+			Err:  err,
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), ".journal-*")
+	if err != nil {
+		return JournalError{
+			Path: j.path,
+			Err:  err,
+		}
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return JournalError{
+			Path: j.path,
+			Err:  err,
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return JournalError{
+			Path: j.path,
+			Err:  err,
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return JournalError{
+			Path: j.path,
+			Err:  err,
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return JournalError{
+			Path: j.path,
+			Err:  err,
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,13 @@
 package locale
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidLocale is wrapped inside LocaleGenError when
+// the given locale isn't inside /etc/locale.gen.
+var ErrInvalidLocale = errors.New("Invalid locale")
 
 // LocaleGenError represents an error that occured
 // when setting up the new install locales.
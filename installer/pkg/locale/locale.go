@@ -1,11 +1,14 @@
 package locale
 
 import (
-	"errors"
+	"bufio"
+	"bytes"
 	"fmt"
-	"os/exec"
+	"slices"
+	"strings"
 
 	"github.com/october-os/october-installer/pkg/arch_chroot"
+	"github.com/october-os/october-installer/pkg/runner"
 )
 
 // Absolute file path to locale.gen
@@ -17,36 +20,58 @@ const filepath string = "/etc/locale.gen"
 // format as it is inside /etc/locale.gen before the space.
 //
 // Can return error types:
-//   - PipeError
 //   - ArchChrootError
-func GenerateLocales(locale string) error {
+func GenerateLocales(r runner.Runner, locale string) error {
 	sedCmd := fmt.Sprintf("sed -i 's/#%s UTF-8/%s UTF-8/' %s", locale, locale, filepath)
 	localeConfCmd := fmt.Sprintf("echo LANG=%s > /etc/locale.conf", locale)
 	localegenCmd := "locale-gen"
 
 	command := fmt.Sprintf("%s && %s && %s", sedCmd, localeConfCmd, localegenCmd)
-	return arch_chroot.Run(command)
+	return arch_chroot.Run(r, command)
 }
 
 // Checks if the given UTF-8 locale exist insides /etc/locale.gen.
 //
 // Can return error types:
 //   - LocaleGenError
-func ValidateLocale(locale string) error {
-	command := fmt.Sprintf("cat %s | grep \"%s UTF-8\"", filepath, locale)
-	cmd := exec.Command("/bin/bash", "-c", command)
-
-	if err := cmd.Run(); err != nil {
-		if cmd.ProcessState.ExitCode() == 1 { // not found
-			return LocaleGenError{
-				Err: errors.New("Invalid locale"),
-			}
-		} else {
-			return LocaleGenError{
-				Err: err,
-			}
+func ValidateLocale(r runner.Runner, locale string) error {
+	locales, err := ListLocales(r)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(locales, locale) {
+		return LocaleGenError{
+			Err: ErrInvalidLocale,
 		}
 	}
 
 	return nil
 }
+
+// Returns every UTF-8 locale listed inside /etc/locale.gen,
+// in the same order and format as GenerateLocales expects.
+//
+// Can return error types:
+//   - LocaleGenError
+func ListLocales(r runner.Runner) ([]string, error) {
+	content, err := r.ReadFile(filepath)
+	if err != nil {
+		return nil, LocaleGenError{
+			Err: err,
+		}
+	}
+
+	locales := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// Locales are listed as "#en_US.UTF-8 UTF-8", the
+		// explanations at the top as "#  en_US ISO-8859-1".
+		line := strings.TrimPrefix(scanner.Text(), "#")
+		if locale, found := strings.CutSuffix(line, " UTF-8"); found && locale != "" && !strings.ContainsAny(locale, " \t") {
+			locales = append(locales, locale)
+		}
+	}
+
+	return locales, nil
+}
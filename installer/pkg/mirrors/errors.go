@@ -1,6 +1,13 @@
 package mirrors
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidCountry is wrapped inside MirrorListError when
+// the given country isn't inside the mirrorlist.
+var ErrInvalidCountry = errors.New("Invalid country")
 
 // MirrorListError represents an error that occured
 // when setting up and saving the mirrorlist file.
@@ -2,30 +2,37 @@ package mirrors
 
 import (
 	"bufio"
-	"errors"
-	"fmt"
-	"os"
-	"os/exec"
+	"bytes"
+	"slices"
 	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
 )
 
 // Absolute path to the mirrorlist file.
 const mirrorlistFile string = "/etc/pacman.d/mirrorlist"
 
+// Country represents a country of the mirrorlist
+// and its number of servers.
+type Country struct {
+	Name    string `json:"name"`
+	Servers int    `json:"servers"`
+}
+
 // Sets the mirrorlist file with only the servers for the
 // given countries and removes all the unused ones.
 //
 // Can return error types:
 //   - MirrorListError
-func SetMirrorList(countries []string) error {
-	mirrorMap, err := getMirrors()
+func SetMirrorList(r runner.Runner, countries []string) error {
+	mirrorMap, err := getMirrors(r)
 	if err != nil {
 		return MirrorListError{
 			err: err,
 		}
 	}
 
-	if err := saveMirrorlist(countries, mirrorMap); err != nil {
+	if err := saveMirrorlist(r, countries, mirrorMap); err != nil {
 		return MirrorListError{
 			err: err,
 		}
@@ -34,60 +41,82 @@ func SetMirrorList(countries []string) error {
 	return nil
 }
 
-// Checks if the given country is present inside mirrorlist.
+// Checks if the given country has servers inside the mirrorlist.
 //
 // Can return errors of types:
 //   - MirrorListError
-func ValidateCountry(country string) error {
-	command := fmt.Sprintf("cat %s | grep %s", mirrorlistFile, country)
-	cmd := exec.Command("/bin/bash", "-c", command)
-
-	if err := cmd.Run(); err != nil {
-		if cmd.ProcessState.ExitCode() == 1 { // Not found
-			return MirrorListError{
-				err: errors.New("Invalid country"),
-			}
-		} else {
-			return MirrorListError{
-				err: err,
-			}
+func ValidateCountry(r runner.Runner, country string) error {
+	countries, err := ListCountries(r)
+	if err != nil {
+		return err
+	}
+
+	if !slices.ContainsFunc(countries, func(c Country) bool { return c.Name == country }) {
+		return MirrorListError{
+			err: ErrInvalidCountry,
 		}
 	}
 
 	return nil
 }
 
-// Saves all the servers of the given countries inside the
-// mirrorlist file.
-func saveMirrorlist(countries []string, mirrorMap map[string][]string) error {
-	file, err := os.Create(mirrorlistFile)
+// Returns every country having at least one server inside the
+// mirrorlist, in the same order.
+//
+// Can return errors of types:
+//   - MirrorListError
+func ListCountries(r runner.Runner) ([]Country, error) {
+	content, err := r.ReadFile(mirrorlistFile)
 	if err != nil {
-		return err
+		return nil, MirrorListError{
+			err: err,
+		}
 	}
-	defer file.Close()
 
+	countries := []Country{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if country, found := strings.CutPrefix(line, "## "); found {
+			countries = append(countries, Country{Name: country})
+		} else if strings.HasPrefix(strings.TrimPrefix(line, "#"), "Server") && len(countries) > 0 {
+			countries[len(countries)-1].Servers++
+		}
+	}
+
+	// The header of the mirrorlist is also written with "## "
+	return slices.DeleteFunc(countries, func(c Country) bool {
+		return c.Servers == 0
+	}), nil
+}
+
+// Saves all the servers of the given countries inside the
+// mirrorlist file, each under its "## <country>" header so that
+// the countries can still be validated and listed afterwards,
+// e.g. when resuming an install.
+func saveMirrorlist(r runner.Runner, countries []string, mirrorMap map[string][]string) error {
+	var content strings.Builder
 	for _, country := range countries {
+		content.WriteString("## " + country + "\n")
 		for _, server := range mirrorMap[country] {
-			if _, err := file.WriteString(server + "\n"); err != nil {
-				return err
-			}
+			content.WriteString(server + "\n")
 		}
 	}
 
-	return nil
+	return r.WriteFile(mirrorlistFile, []byte(content.String()))
 }
 
 // Reads the mirrorlist file and returns a map
 // that has the country name as the key and a slice of
 // all the servers as the value.
-func getMirrors() (map[string][]string, error) {
-	file, err := os.Open(mirrorlistFile)
+func getMirrors(r runner.Runner) (map[string][]string, error) {
+	content, err := r.ReadFile(mirrorlistFile)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
 	var countryMap map[string][]string = make(map[string][]string)
 	var lastCountry string = ""
 
@@ -0,0 +1,147 @@
+package mirrors
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+// mirrorlist is a shortened /etc/pacman.d/mirrorlist of the live system.
+const mirrorlist string = `##
+## Arch Linux repository mirrorlist
+## Generated on 2026-10-01
+##
+
+## Canada
+#Server = https://mirror.csclub.uwaterloo.ca/archlinux/$repo/os/$arch
+#Server = https://mirror.xenyth.net/archlinux/$repo/os/$arch
+
+## France
+#Server = https://mirror.cyberbits.eu/archlinux/$repo/os/$arch
+
+## Antarctica
+
+## United States
+Server = https://mirrors.kernel.org/archlinux/$repo/os/$arch
+`
+
+// Returns a Fake reading the given mirrorlist.
+func fakeWithMirrorlist(content string) *runner.Fake {
+	f := runner.NewFake()
+	f.Files[mirrorlistFile] = []byte(content)
+	return f
+}
+
+func TestListCountries(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Country
+	}{
+		{
+			name:    "live mirrorlist",
+			content: mirrorlist,
+			want: []Country{
+				{Name: "Canada", Servers: 2},
+				{Name: "France", Servers: 1},
+				{Name: "United States", Servers: 1},
+			},
+		},
+		{
+			name:    "empty mirrorlist",
+			content: "",
+			want:    []Country{},
+		},
+		{
+			name:    "servers without country",
+			content: "Server = https://mirrors.kernel.org/archlinux/$repo/os/$arch\n",
+			want:    []Country{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ListCountries(fakeWithMirrorlist(test.content))
+			if err != nil {
+				t.Fatalf("ListCountries() error = %v", err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("ListCountries() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateCountry(t *testing.T) {
+	tests := []struct {
+		country string
+		valid   bool
+	}{
+		{country: "Canada", valid: true},
+		{country: "United States", valid: true},
+		{country: "Can", valid: false},
+		{country: "Antarctica", valid: false},
+		{country: "Canada; rm -rf /", valid: false},
+		{country: "", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.country, func(t *testing.T) {
+			f := fakeWithMirrorlist(mirrorlist)
+
+			err := ValidateCountry(f, test.country)
+			if test.valid && err != nil {
+				t.Errorf("ValidateCountry(%q) error = %v, want nil", test.country, err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidCountry) {
+				t.Errorf("ValidateCountry(%q) error = %v, want %v", test.country, err, ErrInvalidCountry)
+			}
+			if want := []string{"read: " + mirrorlistFile}; !slices.Equal(f.Calls, want) {
+				t.Errorf("calls = %q, want %q", f.Calls, want)
+			}
+		})
+	}
+}
+
+func TestSetMirrorList(t *testing.T) {
+	tests := []struct {
+		name      string
+		countries []string
+		want      string
+	}{
+		{
+			name:      "one country",
+			countries: []string{"France"},
+			want:      "## France\nServer = https://mirror.cyberbits.eu/archlinux/$repo/os/$arch\n\n",
+		},
+		{
+			name:      "countries in the given order",
+			countries: []string{"United States", "Canada"},
+			want: "## United States\nServer = https://mirrors.kernel.org/archlinux/$repo/os/$arch\n" +
+				"## Canada\nServer = https://mirror.csclub.uwaterloo.ca/archlinux/$repo/os/$arch\n" +
+				"Server = https://mirror.xenyth.net/archlinux/$repo/os/$arch\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := fakeWithMirrorlist(mirrorlist)
+
+			if err := SetMirrorList(f, test.countries); err != nil {
+				t.Fatalf("SetMirrorList() error = %v", err)
+			}
+			if got := string(f.Files[mirrorlistFile]); got != test.want {
+				t.Errorf("mirrorlist = %q, want %q", got, test.want)
+			}
+
+			// The countries are validated again when resuming an install
+			for _, country := range test.countries {
+				if err := ValidateCountry(f, country); err != nil {
+					t.Errorf("ValidateCountry(%q) after SetMirrorList() error = %v", country, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package mkinitcpio
+
+import "fmt"
+
+// MkinitcpioError represents an error that occured when
+// trying to configure the initramfs of the new system.
+type MkinitcpioError struct {
+	Err error
+}
+
+// Error returns a formatted error message containing the
+// original error message inside.
+func (e MkinitcpioError) Error() string {
+	return fmt.Sprintf("Mkinitcpio error: error=%s", e.Err.Error())
+}
+
+// Unwrap returns the original error wrapped inside
+// MkinitcpioError.
+func (e MkinitcpioError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,139 @@
+// Package mkinitcpio configures and regenerates the initramfs
+// of the new install, e.g. so it can unlock an encrypted root.
+package mkinitcpio
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/arch_chroot"
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+// mainConfigFile is the configuration installed by mkinitcpio
+// inside the new install, holding its HOOKS.
+const mainConfigFile string = "/mnt/etc/mkinitcpio.conf"
+
+// Drop-in configuration written inside the new install, it
+// overrides the HOOKS of /etc/mkinitcpio.conf.
+const configDirectory string = "/mnt/etc/mkinitcpio.conf.d"
+const configFile string = configDirectory + "/october-installer.conf"
+
+// defaultHooks are the default hooks of mkinitcpio, using systemd,
+// used when /etc/mkinitcpio.conf doesn't exist yet, e.g. when
+// planning an install before pacstrap installed it.
+var defaultHooks []string = []string{
+	"base", "systemd", "autodetect", "microcode", "modconf", "kms",
+	"keyboard", "sd-vconsole", "block", "filesystems", "fsck",
+}
+
+// hooksRegexp matches the HOOKS array of a mkinitcpio configuration
+// written on a single line, capturing the hooks.
+var hooksRegexp *regexp.Regexp = regexp.MustCompile(`^\s*HOOKS=\(([^)]*)\)`)
+
+// Reads the hooks of /etc/mkinitcpio.conf inside the new install,
+// its last HOOKS line winning like when the file is sourced. The
+// default hooks are returned when the file doesn't exist.
+//
+// Can return error types:
+//   - MkinitcpioError
+func readHooks(r runner.Runner) ([]string, error) {
+	content, err := r.ReadFile(mainConfigFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return slices.Clone(defaultHooks), nil
+	}
+	if err != nil {
+		return nil, MkinitcpioError{
+			Err: err,
+		}
+	}
+
+	var hooks []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if match := hooksRegexp.FindStringSubmatch(line); match != nil {
+			hooks = strings.Fields(match[1])
+		}
+	}
+	if hooks == nil {
+		return nil, MkinitcpioError{
+			Err: fmt.Errorf("no HOOKS found inside %s", mainConfigFile),
+		}
+	}
+
+	return hooks, nil
+}
+
+// Returns the given hooks with the extra hooks added right before
+// "filesystems", in the given order. The extra hooks already present
+// are left where they are, the missing ones being added before them
+// when they come first, e.g. sd-encrypt before an existing lvm2.
+//
+// Can return error types:
+//   - MkinitcpioError
+func addHooks(hooks []string, extraHooks ...string) ([]string, error) {
+	next := slices.Index(hooks, "filesystems")
+	if next < 0 {
+		return nil, MkinitcpioError{
+			Err: fmt.Errorf("the hooks %v don't have the filesystems hook to add %v before", hooks, extraHooks),
+		}
+	}
+	if slices.Contains(extraHooks, "sd-encrypt") && !slices.Contains(hooks, "systemd") {
+		return nil, MkinitcpioError{
+			Err: fmt.Errorf("the hooks %v don't use systemd, which the sd-encrypt hook needs", hooks),
+		}
+	}
+
+	// Each hook is added before the ones following it
+	result := slices.Clone(hooks)
+	for _, hook := range slices.Backward(extraHooks) {
+		if i := slices.Index(result, hook); i >= 0 {
+			next = min(next, i)
+			continue
+		}
+		result = slices.Insert(result, next, hook)
+	}
+
+	return result, nil
+}
+
+// Writes a drop-in configuration setting the hooks of the
+// initramfs to the ones of /etc/mkinitcpio.conf plus extraHooks
+// (see addHooks), then regenerates every initramfs of the new
+// install.
+//
+// It executes in arch-chroot:
+//
+//	mkinitcpio -P
+//
+// Can return error types:
+//   - MkinitcpioError
+//   - ArchChrootError
+func Configure(r runner.Runner, extraHooks ...string) error {
+	hooks, err := readHooks(r)
+	if err != nil {
+		return err
+	}
+	hooks, err = addHooks(hooks, extraHooks...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.Run(runner.Command("mkdir", "-p", configDirectory)); err != nil {
+		return MkinitcpioError{
+			Err: err,
+		}
+	}
+
+	content := fmt.Sprintf("# Generated by october-installer\nHOOKS=(%s)\n", strings.Join(hooks, " "))
+	if err := r.WriteFile(configFile, []byte(content)); err != nil {
+		return MkinitcpioError{
+			Err: err,
+		}
+	}
+
+	return arch_chroot.Run(r, "mkinitcpio -P")
+}
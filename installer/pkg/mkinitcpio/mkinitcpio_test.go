@@ -0,0 +1,107 @@
+package mkinitcpio
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name string
+		// config is the content of /etc/mkinitcpio.conf, which
+		// doesn't exist when empty
+		config     string
+		extraHooks []string
+		wantHooks  string
+		wantErr    bool
+	}{
+		{
+			name:       "default hooks",
+			config:     "MODULES=()\n# HOOKS=(base udev)\nHOOKS=(base systemd autodetect microcode modconf kms keyboard sd-vconsole block filesystems fsck)\n",
+			extraHooks: []string{"sd-encrypt", "lvm2"},
+			wantHooks:  "HOOKS=(base systemd autodetect microcode modconf kms keyboard sd-vconsole block sd-encrypt lvm2 filesystems fsck)",
+		},
+		{
+			name:       "customized hooks",
+			config:     "HOOKS=(base systemd plymouth autodetect modconf block filesystems)\n",
+			extraHooks: []string{"sd-encrypt"},
+			wantHooks:  "HOOKS=(base systemd plymouth autodetect modconf block sd-encrypt filesystems)",
+		},
+		{
+			name:       "hook already present",
+			config:     "HOOKS=(base systemd autodetect block lvm2 filesystems fsck)\n",
+			extraHooks: []string{"sd-encrypt", "lvm2"},
+			wantHooks:  "HOOKS=(base systemd autodetect block sd-encrypt lvm2 filesystems fsck)",
+		},
+		{
+			name:       "last HOOKS line",
+			config:     "HOOKS=(base udev block filesystems)\nHOOKS=(base systemd block filesystems)\n",
+			extraHooks: []string{"sd-encrypt"},
+			wantHooks:  "HOOKS=(base systemd block sd-encrypt filesystems)",
+		},
+		{
+			name:       "busybox hooks with lvm2",
+			config:     "HOOKS=(base udev autodetect block filesystems fsck)\n",
+			extraHooks: []string{"lvm2"},
+			wantHooks:  "HOOKS=(base udev autodetect block lvm2 filesystems fsck)",
+		},
+		{
+			name:       "busybox hooks with sd-encrypt",
+			config:     "HOOKS=(base udev autodetect block filesystems fsck)\n",
+			extraHooks: []string{"sd-encrypt"},
+			wantErr:    true,
+		},
+		{
+			name:       "without filesystems hook",
+			config:     "HOOKS=(base systemd block)\n",
+			extraHooks: []string{"lvm2"},
+			wantErr:    true,
+		},
+		{
+			name:       "without HOOKS",
+			config:     "MODULES=()\n",
+			extraHooks: []string{"lvm2"},
+			wantErr:    true,
+		},
+		{
+			name:       "not installed yet",
+			extraHooks: []string{"lvm2"},
+			wantHooks:  "HOOKS=(base systemd autodetect microcode modconf kms keyboard sd-vconsole block lvm2 filesystems fsck)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := runner.NewFake()
+			if test.config != "" {
+				f.Files[mainConfigFile] = []byte(test.config)
+			}
+
+			err := Configure(f, test.extraHooks...)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Configure() error = %v, want error %t", err, test.wantErr)
+			}
+			if test.wantErr {
+				if want := []string{"read: " + mainConfigFile}; !slices.Equal(f.Calls, want) {
+					t.Errorf("calls = %q, want %q", f.Calls, want)
+				}
+				return
+			}
+
+			wantCalls := []string{
+				"read: " + mainConfigFile,
+				"run: mkdir -p " + configDirectory,
+				"write: " + configFile,
+				"chroot: /bin/bash -c 'mkinitcpio -P'",
+			}
+			if !slices.Equal(f.Calls, wantCalls) {
+				t.Errorf("calls = %q, want %q", f.Calls, wantCalls)
+			}
+			if want := "# Generated by october-installer\n" + test.wantHooks + "\n"; string(f.Files[configFile]) != want {
+				t.Errorf("%s = %q, want %q", configFile, f.Files[configFile], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package partition
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+// Directory the top-level volume of a btrfs file system is mounted on
+// inside the live system while its subvolumes get created
+const btrfsTopLevelDirectory string = "/run/october-installer/btrfs"
+
+// Subvolumes are created directly inside the top-level volume, e.g. "@" or "@var_log"
+var subvolumeNameRegexp *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9_@.+-]{1,255}$`)
+
+// Subvolume represents a btrfs subvolume created inside the top-level volume of a partition
+// Possible attributes values:
+// - Name: letters, digits and '_', '@', '.', '+', '-', e.g. "@" or "@home"
+// - MountPoint: an absolute Linux filesystem path, or string default value to create it without mounting it
+// - MountOptions: options given to mount and written inside fstab after the MountOptions of the partition,
+// e.g. "compress=zstd" or "noatime", supported by btrfs (see supportedMountOptions); "subvol" is set by the installer
+type Subvolume struct {
+	Name         string   `json:"name"`
+	MountPoint   string   `json:"mountPoint"`
+	MountOptions []string `json:"mountOptions,omitempty"`
+}
+
+// Checks the attributes of a Subvolume struct
+// Adds every problem found to the report, path being the JSON path of the subvolume
+func (s *Subvolume) Check(path string, report *validation.Report) {
+	if !subvolumeNameRegexp.MatchString(s.Name) || s.Name == "." || s.Name == ".." {
+		report.Add(validation.Field(path, "name"), validation.CodeInvalidFormat, "Name is in the wrong format: should be letters, digits, '_', '@', '.', '+' or '-'")
+	}
+	if s.MountPoint != "" && !filepath.IsAbs(s.MountPoint) {
+		report.Add(validation.Field(path, "mountPoint"), validation.CodeInvalidFormat, "MountPoint is in the wrong format: should start by '/'")
+	}
+	checkMountOptions(validation.Field(path, "mountOptions"), fileSystemBtrfs, s.MountOptions, report)
+}
+
+// Checks the subvolumes of a partition or a logical volume formatted with fileSystem,
+// path being the JSON path of their parent
+func checkSubvolumes(path string, subvolumes []Subvolume, fileSystem string, mountPoint string, report *validation.Report) {
+	if len(subvolumes) == 0 {
+		return
+	}
+
+	subvolumesPath := validation.Field(path, "subvolumes")
+	if fileSystem != fileSystemBtrfs {
+		report.Add(subvolumesPath, validation.CodeInvalid, "Subvolumes can only be created on a btrfs file system")
+	}
+	if mountPoint != "" {
+		report.Add(validation.Field(path, "mountPoint"), validation.CodeInvalid, "The subvolumes are mounted instead, MountPoint must not be defined")
+	}
+
+	for i := range subvolumes {
+		subvolumePath := validation.Index(subvolumesPath, i)
+		subvolumes[i].Check(subvolumePath, report)
+		if slices.ContainsFunc(subvolumes[:i], func(other Subvolume) bool { return other.Name == subvolumes[i].Name }) {
+			report.Add(validation.Field(subvolumePath, "name"), validation.CodeInvalid, fmt.Sprintf("Subvolume '%s' is already defined", subvolumes[i].Name))
+		}
+	}
+}
+
+// Returns the options mounting the subvolume: its MountOptions followed by 'subvol=/<name>'
+func (s *Subvolume) mountOptions() []string {
+	return append(slices.Clone(s.MountOptions), "subvol=/"+s.Name)
+}
+
+// Creates the subvolumes of a btrfs partition, its top-level volume
+// being mounted while they get created, and unmounted even when the creation fails
+//
+// It executes:
+//
+//	mount --mkdir <device> /run/october-installer/btrfs
+//	btrfs subvolume create /run/october-installer/btrfs/<name>
+//	umount /run/october-installer/btrfs
+//
+// Can return one type of error: SetupPartitionsError
+func createSubvolumes(r runner.Runner, mapped MappedPartition) (err error) {
+	subvolumes := mapped.Partition.Subvolumes
+	if len(subvolumes) == 0 {
+		return nil
+	}
+
+	device := mapped.Device()
+	if _, err := r.Run(runner.Command("mount", "--mkdir", device, btrfsTopLevelDirectory)); err != nil {
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("error mounting the top-level volume of '%s': error=%s", device, err.Error()),
+		}
+	}
+	defer func() {
+		if _, umountErr := r.Run(runner.Command("umount", btrfsTopLevelDirectory)); umountErr != nil && err == nil {
+			err = &SetupPartitionsError{
+				Err: fmt.Errorf("error unmounting the top-level volume of '%s': error=%s", device, umountErr.Error()),
+			}
+		}
+	}()
+
+	for _, s := range subvolumes {
+		if _, err := r.Run(runner.Command("btrfs", "subvolume", "create", filepath.Join(btrfsTopLevelDirectory, s.Name))); err != nil {
+			return &SetupPartitionsError{
+				Err: fmt.Errorf("error creating subvolume '%s' on '%s': error=%s", s.Name, device, err.Error()),
+			}
+		}
+	}
+	return nil
+}
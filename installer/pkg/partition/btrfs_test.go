@@ -0,0 +1,84 @@
+package partition
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+func TestCreateSubvolumes(t *testing.T) {
+	mapped := MappedPartition{
+		Partition: Partition{
+			FileSystem:    fileSystemBtrfs,
+			PartitionType: gptPartitionTypeRoot,
+			Subvolumes:    []Subvolume{{Name: "@", MountPoint: "/"}, {Name: "@home", MountPoint: "/home"}},
+		},
+		Node:  "/dev/sda2",
+		Drive: "/dev/sda",
+	}
+
+	tests := []struct {
+		name string
+		// failing is the command scripted to fail, if any
+		failing   string
+		wantCalls []string
+		wantErr   bool
+	}{
+		{
+			name: "created",
+			wantCalls: []string{
+				"run: mount --mkdir /dev/sda2 /run/october-installer/btrfs",
+				"run: btrfs subvolume create /run/october-installer/btrfs/@",
+				"run: btrfs subvolume create /run/october-installer/btrfs/@home",
+				"run: umount /run/october-installer/btrfs",
+			},
+		},
+		{
+			name:    "mount failing",
+			failing: "mount --mkdir /dev/sda2 /run/october-installer/btrfs",
+			wantCalls: []string{
+				"run: mount --mkdir /dev/sda2 /run/october-installer/btrfs",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "subvolume creation failing",
+			failing: "btrfs subvolume create /run/october-installer/btrfs/@",
+			wantCalls: []string{
+				"run: mount --mkdir /dev/sda2 /run/october-installer/btrfs",
+				"run: btrfs subvolume create /run/october-installer/btrfs/@",
+				"run: umount /run/october-installer/btrfs",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "umount failing",
+			failing: "umount /run/october-installer/btrfs",
+			wantCalls: []string{
+				"run: mount --mkdir /dev/sda2 /run/october-installer/btrfs",
+				"run: btrfs subvolume create /run/october-installer/btrfs/@",
+				"run: btrfs subvolume create /run/october-installer/btrfs/@home",
+				"run: umount /run/october-installer/btrfs",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := runner.NewFake()
+			if test.failing != "" {
+				f.On(test.failing, runner.Result{ExitCode: 1, Stderr: "failed"})
+			}
+
+			err := createSubvolumes(f, mapped)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("createSubvolumes() error = %v, want error %t", err, test.wantErr)
+			}
+			if !slices.Equal(f.Calls, test.wantCalls) {
+				t.Errorf("calls = %q, want %q", f.Calls, test.wantCalls)
+			}
+		})
+	}
+}
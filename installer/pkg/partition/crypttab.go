@@ -0,0 +1,156 @@
+package partition
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+// Absolute path of the crypttab file of the new install
+const crypttabFile string = "/mnt/etc/crypttab"
+
+// Directory of the new install holding the key files of the encrypted partitions
+const keyFilesDirectory string = "/etc/cryptsetup-keys.d"
+
+// CrypttabEntry represents one line of /etc/crypttab
+type CrypttabEntry struct {
+	Name   string
+	Source string
+	// KeyFile is the path of the key file inside the new install,
+	// "none" to ask the passphrase at boot
+	KeyFile string
+	Options string
+}
+
+// Returns the entry in the crypttab format
+//
+// Example:
+// "crypthome	UUID=0a3407de-014b-458b-b5c1-848e92a327a3	none	luks"
+func (e CrypttabEntry) String() string {
+	return fmt.Sprintf("%s\t%s\t%s\t%s", e.Name, e.Source, e.KeyFile, e.Options)
+}
+
+// Writes the crypttab of the new install from the Layout and copies the key files
+// of the encrypted partitions into it, the base system needs to be installed
+// The root partition and the physical volumes of the volume group holding the root
+// logical volume aren't listed, they are unlocked by the initramfs (see KernelParameters)
+//
+// It executes, for each key file:
+//
+//	install -D -m 0400 <key file> /mnt/etc/cryptsetup-keys.d/<name>.key
+//
+// Can return one type of error: SetupPartitionsError
+func WriteCrypttab(r runner.Runner, layout Layout) error {
+	var content strings.Builder
+	content.WriteString("# /etc/crypttab: encrypted devices unlocked at boot, generated by october-installer\n")
+	content.WriteString("#\n# <name>\t<device>\t<password>\t<options>\n\n")
+
+	for _, mapped := range layout {
+		e := mapped.Partition.Encryption
+		if e == nil || layout.unlockedByInitramfs(mapped) {
+			continue
+		}
+
+		uuid, err := luksUuid(r, mapped.Node)
+		if err != nil {
+			return err
+		}
+
+		entry := CrypttabEntry{
+			Name:    mapped.Partition.mapperName(),
+			Source:  "UUID=" + uuid,
+			KeyFile: "none",
+			Options: "luks",
+		}
+		if e.KeyFile != "" {
+			entry.KeyFile = filepath.Join(keyFilesDirectory, entry.Name+".key")
+			cmd := runner.Command("install", "-D", "-m", "0400", e.KeyFile, filepath.Join(targetRoot, entry.KeyFile))
+			if _, err := r.Run(cmd); err != nil {
+				return &SetupPartitionsError{
+					Err: fmt.Errorf("error copying key file '%s' into the new install: error=%s", e.KeyFile, err.Error()),
+				}
+			}
+		}
+		content.WriteString(entry.String() + "\n")
+	}
+
+	if err := r.WriteFile(crypttabFile, []byte(content.String())); err != nil {
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("error writing '%s': error=%s", crypttabFile, err.Error()),
+		}
+	}
+	return nil
+}
+
+// Returns the kernel parameters unlocking the encrypted root partition of the Layout, or
+// the encrypted physical volumes of the volume group holding the root logical volume,
+// with the sd-encrypt hook of the initramfs, none if they aren't encrypted
+//
+// Example:
+// "rd.luks.name=0a3407de-014b-458b-b5c1-848e92a327a3=cryptroot"
+//
+// Can return one type of error: SetupPartitionsError
+func KernelParameters(r runner.Runner, layout Layout) ([]string, error) {
+	var parameters []string
+	for _, mapped := range layout {
+		if mapped.Partition.Encryption == nil || !layout.unlockedByInitramfs(mapped) {
+			continue
+		}
+
+		uuid, err := luksUuid(r, mapped.Node)
+		if err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, fmt.Sprintf("rd.luks.name=%s=%s", uuid, mapped.Partition.mapperName()))
+	}
+	return parameters, nil
+}
+
+// Returns true if the partition needs to be unlocked by the initramfs to mount /: it is
+// the root partition, or a physical volume of the volume group holding the root logical volume
+func (l Layout) unlockedByInitramfs(mapped MappedPartition) bool {
+	if isRoot(mapped.Partition) {
+		return mapped.LogicalVolume == nil
+	}
+	if mapped.VolumeGroup == "" || mapped.LogicalVolume != nil {
+		return false
+	}
+	return slices.ContainsFunc(l, func(other MappedPartition) bool {
+		return other.LogicalVolume != nil && other.VolumeGroup == mapped.VolumeGroup && isRoot(other.Partition)
+	})
+}
+
+// Returns true if the partition holding /boot, or / when /boot isn't a separate
+// partition, is encrypted: Grub needs to unlock it
+func (l Layout) BootEncrypted() bool {
+	var partitions []Partition
+	for _, mapped := range l {
+		partitions = append(partitions, mapped.Partition)
+	}
+	i := bootPartitionIndex(partitions)
+	return i >= 0 && l[i].Partition.Encryption != nil
+}
+
+// Returns the UUID of the LUKS header of the encrypted partition at path
+//
+// Can return one type of error: SetupPartitionsError
+func luksUuid(r runner.Runner, path string) (string, error) {
+	uuid, err := queryBlkid(r, "UUID", path)
+	if err != nil {
+		return "", err
+	}
+	if uuid == "" {
+		return "", &SetupPartitionsError{
+			Err: fmt.Errorf("error getting the UUID of encrypted partition '%s': partition has no UUID", path),
+		}
+	}
+	return uuid, nil
+}
+
+// Returns true if the partition, or one of its subvolumes, is mounted at '/'
+func isRoot(p Partition) bool {
+	return p.holds("/")
+}
@@ -0,0 +1,65 @@
+package partition
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+// Finds the partitions the drive deletes, and removes them from state so the
+// space they free can be used by the new partitions, state being the output
+// of 'sfdisk --json <drive>'
+//
+// Returns the nodes of the deleted partitions
+// Can return one type of error: SetupPartitionsError
+func findDeletedPartitions(r runner.Runner, drive Drive, state *SfdiskJsonDrive) ([]string, error) {
+	var nodes []string
+	for _, ref := range drive.Delete {
+		found, err := ref.find(r, drive.Path, state)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(nodes, found.Node) {
+			return nil, &SetupPartitionsError{
+				Err: fmt.Errorf("error finding partition '%s': '%s' is already deleted", ref.String(), found.Node),
+			}
+		}
+		nodes = append(nodes, found.Node)
+	}
+
+	state.PartitionTable.Partitions = slices.DeleteFunc(state.PartitionTable.Partitions, func(p SfdiskJsonPartition) bool {
+		return slices.Contains(nodes, p.Node)
+	})
+	return nodes, nil
+}
+
+// Deletes the partitions of the drive found by Fit, their data being left on the drive
+//
+// It executes:
+//
+//	sfdisk --delete <drive> <number>...
+//
+// Can return one type of error: SetupPartitionsError
+func deletePartitions(r runner.Runner, drive string, nodes []string) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	args := []string{"--delete", drive}
+	for _, node := range nodes {
+		number, err := partitionNumber(node)
+		if err != nil {
+			return err
+		}
+		args = append(args, strconv.Itoa(number))
+	}
+
+	if _, err := r.Run(runner.Command("sfdisk", args...)); err != nil {
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("error deleting partitions of drive '%s' using sfdisk: error=%s", drive, err.Error()),
+		}
+	}
+	return nil
+}
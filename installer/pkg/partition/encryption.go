@@ -0,0 +1,261 @@
+package partition
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+const (
+	luksVersion1 string = "luks1"
+	luksVersion2 string = "luks2"
+)
+
+var supportedLuksVersions []string = []string{
+	luksVersion1,
+	luksVersion2,
+}
+
+// Directory of the mapped devices of the opened LUKS partitions
+const mapperDirectory string = "/dev/mapper"
+
+// Labels are used as mapped device names, so they are kept to simple names
+var luksLabelRegexp *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,48}$`)
+
+// Ciphers are given as is to cryptsetup, e.g. "aes-xts-plain64"
+var luksCipherRegexp *regexp.Regexp = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// Encryption represents the LUKS encryption of a Partition
+// Possible attributes values:
+// - Passphrase: the passphrase asked at boot, or string default value when KeyFile is defined
+// - KeyFile: an absolute path on the live system of a file holding the key, or string default value;
+// it is copied into the new install and can't be used by the root partition, its passphrase being asked at boot
+// - Cipher: a cipher supported by cryptsetup, e.g. "aes-xts-plain64", or string default value for the cryptsetup default
+// - Version: a LUKS version present in the supportedLuksVersions slice above, or string default value for LUKS2
+// - Label: the label of the LUKS2 header, also used as the name of the mapped device, or string default value
+//
+// Without a Label, the mapped device is named after the mount point, e.g. "cryptroot" for '/',
+// "crypthome" for '/home' or "cryptswap" for the swap partition
+type Encryption struct {
+	Passphrase string `json:"passphrase,omitempty"`
+	KeyFile    string `json:"keyFile,omitempty"`
+	Cipher     string `json:"cipher,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Label      string `json:"label,omitempty"`
+}
+
+// Checks the attributes of an Encryption struct
+// Adds every problem found to the report, path being the JSON path of the encryption
+func (e *Encryption) Check(path string, report *validation.Report) {
+	switch {
+	case e.Passphrase != "" && e.KeyFile != "":
+		report.Add(validation.Field(path, "keyFile"), validation.CodeInvalid, "Passphrase and KeyFile can't be used together")
+	case e.KeyFile != "":
+		if !filepath.IsAbs(e.KeyFile) {
+			report.Add(validation.Field(path, "keyFile"), validation.CodeInvalidFormat, "KeyFile is in the wrong format: should be an absolute path")
+		}
+	case strings.TrimSpace(e.Passphrase) == "":
+		report.Add(validation.Field(path, "passphrase"), validation.CodeRequired, "Passphrase is not defined, but the partition is encrypted without a KeyFile")
+	}
+
+	if e.Cipher != "" && !luksCipherRegexp.MatchString(e.Cipher) {
+		report.Add(validation.Field(path, "cipher"), validation.CodeInvalidFormat, "Cipher is in the wrong format: should be like 'aes-xts-plain64'")
+	}
+	if e.Version != "" && !slices.Contains(supportedLuksVersions, e.Version) {
+		report.Add(validation.Field(path, "version"), validation.CodeUnsupported, "specified Version is not supported")
+	}
+	if e.Label != "" && !luksLabelRegexp.MatchString(e.Label) {
+		report.Add(validation.Field(path, "label"), validation.CodeInvalidFormat, "Label is in the wrong format: should be at most 48 letters, digits, '-' or '_'")
+	}
+}
+
+// Returns the LUKS version of the encryption, LUKS2 when not defined
+func (e *Encryption) version() string {
+	if e.Version == "" {
+		return luksVersion2
+	}
+	return e.Version
+}
+
+// Returns the name of the mapped device of the encrypted partition: its encryption Label,
+// or a name made from its mount point, e.g. "cryptroot", "crypthome" or "cryptvar-log"
+// The mount point closest to '/' is used when the partition has subvolumes
+// Returns an empty string if the partition isn't encrypted, or has neither a Label nor a mount point
+func (p *Partition) mapperName() string {
+	mountPoint := p.mainMountPoint()
+	switch {
+	case p.Encryption == nil:
+		return ""
+	case p.Encryption.Label != "":
+		return p.Encryption.Label
+	case p.IsSwap():
+		return "cryptswap"
+	case mountPoint == "":
+		return ""
+	case mountPoint == "/":
+		return "cryptroot"
+	}
+	return "crypt" + strings.ReplaceAll(strings.Trim(mountPoint, "/"), "/", "-")
+}
+
+// Returns the key given to cryptsetup through STDIN and the key file argument:
+// "-" to read the passphrase from STDIN, or the path of the key file
+func (e *Encryption) key() (string, string) {
+	if e.KeyFile != "" {
+		return "", e.KeyFile
+	}
+	return e.Passphrase, "-"
+}
+
+// Returns the device the partition file system is created on: the mapped
+// device of an encrypted partition, its node otherwise
+func (m MappedPartition) Device() string {
+	if name := m.Partition.mapperName(); name != "" {
+		return filepath.Join(mapperDirectory, name)
+	}
+	return m.Node
+}
+
+// Returns true if at least one partition of the Layout is encrypted
+func (l Layout) Encrypted() bool {
+	return slices.ContainsFunc(l, func(mapped MappedPartition) bool {
+		return mapped.Partition.Encryption != nil
+	})
+}
+
+// Returns a copy of the Layout without the passphrases of the encrypted
+// partitions, e.g. to save it inside a file
+func (l Layout) WithoutPassphrases() Layout {
+	layout := slices.Clone(l)
+	for i := range layout {
+		layout[i].Partition = layout[i].Partition.withoutPassphrase()
+	}
+	return layout
+}
+
+// Returns a copy of the Drive without the passphrases of its encrypted
+// partitions, e.g. to save it inside a file
+func (d Drive) WithoutPassphrases() Drive {
+	d.Partitions = slices.Clone(d.Partitions)
+	for i := range d.Partitions {
+		d.Partitions[i] = d.Partitions[i].withoutPassphrase()
+	}
+	return d
+}
+
+// Returns a copy of the Partition without its passphrase when it is encrypted
+func (p Partition) withoutPassphrase() Partition {
+	if p.Encryption != nil {
+		withoutPassphrase := *p.Encryption
+		withoutPassphrase.Passphrase = ""
+		p.Encryption = &withoutPassphrase
+	}
+	return p
+}
+
+// Sets the passphrases of the encrypted partitions back from the drives
+// the Layout was created from, e.g. after loading it from a file
+// The partitions of the drives must be in the same order as the Layout,
+// the logical volumes following them aren't encrypted
+func (l Layout) RestorePassphrases(drives []Drive) {
+	var partitions []Partition
+	for _, drive := range drives {
+		partitions = append(partitions, drive.Partitions...)
+	}
+	if len(partitions) > len(l) {
+		return
+	}
+
+	for i := range partitions {
+		if e := l[i].Partition.Encryption; e != nil && partitions[i].Encryption != nil {
+			withPassphrase := *e
+			withPassphrase.Passphrase = partitions[i].Encryption.Passphrase
+			l[i].Partition.Encryption = &withPassphrase
+		}
+	}
+}
+
+// Encrypts the partition with LUKS and opens it, its mapped device
+// can then be formatted
+//
+// It executes:
+//
+//	cryptsetup luksFormat --batch-mode --type <version> [--cipher <cipher>] [--label <label>] --key-file <key file|-> <node>
+//	cryptsetup open --key-file <key file|-> <node> <name>
+//
+// The label is only written on LUKS2, LUKS1 headers don't have one
+//
+// Can return one type of error: SetupPartitionsError
+func encryptPartition(r runner.Runner, mapped MappedPartition) error {
+	e := mapped.Partition.Encryption
+	input, keyFile := e.key()
+
+	args := []string{"luksFormat", "--batch-mode", "--type", e.version()}
+	if e.Cipher != "" {
+		args = append(args, "--cipher", e.Cipher)
+	}
+	if e.Label != "" && e.version() == luksVersion2 {
+		args = append(args, "--label", e.Label)
+	}
+	args = append(args, "--key-file", keyFile, mapped.Node)
+
+	cmd := runner.Command("cryptsetup", args...)
+	cmd.Stdin = input
+	cmd.Secret = true
+	if _, err := r.Run(cmd); err != nil {
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("error encrypting partition '%s': error=%s", mapped.Node, err.Error()),
+		}
+	}
+
+	return openPartition(r, mapped)
+}
+
+// Opens the encrypted partition on its mapped device
+//
+// Can return one type of error: SetupPartitionsError
+func openPartition(r runner.Runner, mapped MappedPartition) error {
+	input, keyFile := mapped.Partition.Encryption.key()
+
+	cmd := runner.Command("cryptsetup", "open", "--key-file", keyFile, mapped.Node, mapped.Partition.mapperName())
+	cmd.Stdin = input
+	cmd.Secret = true
+	if _, err := r.Run(cmd); err != nil {
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("error opening encrypted partition '%s': error=%s", mapped.Node, err.Error()),
+		}
+	}
+	return nil
+}
+
+// Opens every encrypted partition of the Layout that isn't already opened
+// Useful to resume an installation after the mapped devices were lost, e.g. after a reboot
+//
+// Can return one type of error: SetupPartitionsError
+func reopenPartitions(r runner.Runner, layout Layout) error {
+	for _, mapped := range layout {
+		if mapped.Partition.Encryption == nil {
+			continue
+		}
+
+		result, err := r.Query(runner.Command("cryptsetup", "status", mapped.Partition.mapperName()))
+		if err == nil {
+			continue
+		}
+		if result.ExitCode != 4 { // 4: the mapped device isn't active
+			return &SetupPartitionsError{
+				Err: fmt.Errorf("error checking if encrypted partition '%s' is opened: error=%s", mapped.Node, err.Error()),
+			}
+		}
+
+		if err := openPartition(r, mapped); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package partition
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // ValidationError represents an error that occured
 // after validating a struct's attributes
@@ -57,3 +60,21 @@ func (e *PartitionTableCompatibilityError) Error() string {
 func (e *PartitionTableCompatibilityError) Unwrap() error {
 	return e.Err
 }
+
+// DriveFitError represents partitions that don't fit
+// on their drive, the FitReport telling why
+type DriveFitError struct {
+	Report *FitReport
+}
+
+// Returns the problem of every drive the partitions
+// don't fit on
+func (e *DriveFitError) Error() string {
+	var problems []string
+	for _, d := range e.Report.Drives {
+		if !d.Fits {
+			problems = append(problems, d.Problem)
+		}
+	}
+	return fmt.Sprintf("partitions don't fit: %s", strings.Join(problems, "; "))
+}
@@ -0,0 +1,245 @@
+package partition
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+// File system type given by blkid to an encrypted partition
+const fileSystemLuks string = "crypto_LUKS"
+
+// PartitionReference references a partition already on a drive
+// Possible attributes values, exactly one of them being defined:
+// - Number: the number of the partition on its drive, e.g. 5 for "/dev/nvme0n1p5"
+// - Node: the device node of the partition, e.g. "/dev/nvme0n1p5"
+// - PartUuid: the PARTUUID of the partition, e.g. "6f0b5d4e-3c1a-4b8e-9a0f-2d7c5e1b8a93",
+// or "<disk identifier>-<number>" on a DOS partition table
+// - Label: the label of the file system on the partition
+type PartitionReference struct {
+	Number   int    `json:"number,omitempty"`
+	Node     string `json:"node,omitempty"`
+	PartUuid string `json:"partUuid,omitempty"`
+	Label    string `json:"label,omitempty"`
+}
+
+// ExistingPartition represents a partition already on the drive, reused instead of creating a new one
+// Possible attributes values:
+// - Number, Node, PartUuid, Label: see PartitionReference
+// - Format: formats the partition like a new one, erasing its data; otherwise it must already
+// hold the FileSystem of the partition (or LUKS when it is encrypted), which is mounted as is
+type ExistingPartition struct {
+	PartitionReference
+	Format bool `json:"format"`
+}
+
+// Checks the attributes of a PartitionReference struct
+// Adds every problem found to the report, path being the JSON path of the reference
+func (ref *PartitionReference) Check(path string, report *validation.Report) {
+	defined := 0
+	if ref.Number != 0 {
+		defined++
+	}
+	for _, value := range []string{ref.Node, ref.PartUuid, ref.Label} {
+		if value != "" {
+			defined++
+		}
+	}
+	if defined != 1 {
+		report.Add(path, validation.CodeInvalid, "Exactly one of Number, Node, PartUuid and Label must be defined")
+	}
+	if ref.Number < 0 {
+		report.Add(validation.Field(path, "number"), validation.CodeOutOfRange, "Number must be greater or equal 1")
+	}
+	if ref.Node != "" && !strings.HasPrefix(ref.Node, "/dev/") {
+		report.Add(validation.Field(path, "node"), validation.CodeInvalidFormat, "Node is in the wrong format: should start by '/dev/'")
+	}
+}
+
+// Returns how the partition is referenced, e.g. "number 2", "/dev/sda2",
+// "PARTUUID=<partuuid>" or "LABEL=<label>"
+func (ref *PartitionReference) String() string {
+	switch {
+	case ref.Number != 0:
+		return fmt.Sprintf("number %d", ref.Number)
+	case ref.PartUuid != "":
+		return "PARTUUID=" + strings.ToLower(ref.PartUuid)
+	case ref.Label != "":
+		return "LABEL=" + ref.Label
+	}
+	return ref.Node
+}
+
+// Checks the attributes of a Partition reusing an existing partition,
+// path being the JSON path of the partition
+func (p *Partition) checkExisting(path string, report *validation.Report) {
+	existingPath := validation.Field(path, "existing")
+	p.Existing.Check(existingPath, report)
+
+	if p.Size != (PartitionSize{}) {
+		report.Add(validation.Field(path, "size"), validation.CodeInvalid, "An existing partition keeps its size, Size must not be defined")
+	}
+	if !p.needsFormatting() {
+		report.Add(validation.Field(path, "partitionType"), validation.CodeInvalid, "Only a partition with a file system can be reused, not a BIOS boot or Linux LVM partition")
+	}
+	if p.Existing.Format {
+		return
+	}
+
+	if p.Label != "" {
+		report.Add(validation.Field(path, "label"), validation.CodeInvalid, "Label is written by mkfs, it can only be defined when the existing partition gets formatted")
+	}
+	if p.Uuid != "" {
+		report.Add(validation.Field(path, "uuid"), validation.CodeInvalid, "Uuid is written by mkfs, it can only be defined when the existing partition gets formatted")
+	}
+	if len(p.MkfsOptions) > 0 {
+		report.Add(validation.Field(path, "mkfsOptions"), validation.CodeInvalid, "MkfsOptions can only be defined when the existing partition gets formatted")
+	}
+	for _, m := range p.mountPoints(path) {
+		if m.mountPoint == "/" {
+			report.Add(validation.Field(existingPath, "format"), validation.CodeInvalid, "The partition mounted at '/' must be formatted, the new install can't be written over an old one")
+		}
+	}
+}
+
+// Returns true if the partition gets formatted: a new partition with a file system,
+// or an existing one with Format set
+func (p *Partition) formats() bool {
+	return p.needsFormatting() && (p.Existing == nil || p.Existing.Format)
+}
+
+// Returns the partitions of the drive that need to be created, without the existing ones
+func (d *Drive) newPartitions() []Partition {
+	return slices.DeleteFunc(slices.Clone(d.Partitions), func(p Partition) bool {
+		return p.Existing != nil
+	})
+}
+
+// Finds the node of every existing partition of the drives, before anything gets written,
+// and checks it: it must be a partition of its drive, hold the FileSystem of the partition
+// (or LUKS when it is encrypted) unless it gets formatted, and be reused only once
+//
+// It executes, for each drive with existing partitions:
+//
+//	sfdisk --json <drive>
+//	blkid --list-one --output device --match-token PARTUUID|LABEL=<value> (only if referenced by PartUuid or Label)
+//	blkid --match-tag TYPE --output value <node> (only if not formatted)
+//
+// Returns the node of each partition of each drive, empty for the partitions to create
+// Can return one type of error: SetupPartitionsError
+func resolveExistingPartitions(r runner.Runner, drives []Drive) ([][]string, error) {
+	nodes := make([][]string, len(drives))
+	// Existing partition using each node
+	used := make(map[string]string)
+
+	for i, drive := range drives {
+		nodes[i] = make([]string, len(drive.Partitions))
+		if len(drive.newPartitions()) == len(drive.Partitions) {
+			continue
+		}
+
+		state, err := getDriveStateWithSfdisk(r, drive.Path)
+		if err != nil {
+			return nil, err
+		}
+		for j, p := range drive.Partitions {
+			if p.Existing == nil {
+				continue
+			}
+
+			found, err := p.Existing.find(r, drive.Path, state)
+			if err != nil {
+				return nil, err
+			}
+			node := found.Node
+			if other, found := used[node]; found {
+				return nil, &SetupPartitionsError{
+					Err: fmt.Errorf("error finding existing partition '%s': '%s' is already reused as '%s'", p.Existing, node, other),
+				}
+			}
+			used[node] = p.Existing.String()
+
+			if !p.Existing.Format {
+				if err := checkExistingFileSystem(r, p, node); err != nil {
+					return nil, err
+				}
+			}
+			nodes[i][j] = node
+		}
+	}
+	return nodes, nil
+}
+
+// Finds the referenced partition among the partitions of the drive, its node being
+// found with blkid when it is referenced by its PartUuid or Label
+//
+// It executes:
+//
+//	blkid --list-one --output device --match-token PARTUUID|LABEL=<value> (only if referenced by PartUuid or Label)
+//
+// Returns the partition as listed by 'sfdisk --json <drive>', state being its output
+// Can return one type of error: SetupPartitionsError
+func (ref *PartitionReference) find(r runner.Runner, drive string, state *SfdiskJsonDrive) (SfdiskJsonPartition, error) {
+	node := ref.Node
+	if ref.Number != 0 {
+		i := slices.IndexFunc(state.PartitionTable.Partitions, func(p SfdiskJsonPartition) bool {
+			number, err := partitionNumber(p.Node)
+			return err == nil && number == ref.Number
+		})
+		if i < 0 {
+			return SfdiskJsonPartition{}, &SetupPartitionsError{
+				Err: fmt.Errorf("error finding partition '%s': drive '%s' has no partition %d", ref, drive, ref.Number),
+			}
+		}
+		return state.PartitionTable.Partitions[i], nil
+	}
+	if node == "" {
+		result, err := r.Query(runner.Command("blkid", "--list-one", "--output", "device", "--match-token", ref.String()))
+		if err != nil {
+			return SfdiskJsonPartition{}, &SetupPartitionsError{
+				Err: fmt.Errorf("error finding partition '%s': error=%s", ref, err.Error()),
+			}
+		}
+		node = strings.TrimSpace(result.Stdout)
+		if node == "" {
+			return SfdiskJsonPartition{}, &SetupPartitionsError{
+				Err: fmt.Errorf("error finding partition '%s': no partition matches", ref),
+			}
+		}
+	}
+
+	i := slices.IndexFunc(state.PartitionTable.Partitions, func(p SfdiskJsonPartition) bool { return p.Node == node })
+	if i < 0 {
+		return SfdiskJsonPartition{}, &SetupPartitionsError{
+			Err: fmt.Errorf("error finding partition '%s': '%s' is not a partition of drive '%s'", ref, node, drive),
+		}
+	}
+	return state.PartitionTable.Partitions[i], nil
+}
+
+// Checks that the existing partition at node holds the file system of the
+// partition, or LUKS when it is encrypted, since it gets mounted without being formatted
+//
+// Can return one type of error: SetupPartitionsError
+func checkExistingFileSystem(r runner.Runner, p Partition, node string) error {
+	expected := p.fileSystem()
+	if p.Encryption != nil {
+		expected = fileSystemLuks
+	}
+
+	result, err := r.Query(runner.Command("blkid", "--match-tag", "TYPE", "--output", "value", node))
+	if err != nil {
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("error getting the file system of existing partition '%s': error=%s", node, err.Error()),
+		}
+	}
+	if current := strings.TrimSpace(result.Stdout); current != expected {
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("existing partition '%s' holds '%s' instead of '%s', set Format to format it", node, current, expected),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package partition
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+// Partitions start on a multiple of 1 MiB, like sfdisk does by default
+const partitionAlignment int64 = 1 << 20
+
+// Size of the GPT partition entries, a copy of them and of the
+// GPT header are kept at the end of the drive
+const gptEntriesSize int64 = 16384
+
+// A DOS partition table addresses sectors with 32 bits, the
+// sectors after them can't be used
+const dosMaxSectors int64 = 1 << 32
+
+// FitReport represents whether the partitions of every drive fit on it
+type FitReport struct {
+	Drives []DriveFit `json:"drives"`
+}
+
+// DriveFit represents where the partitions of a drive would be created
+// and whether they fit on it, every size and offset being in bytes
+type DriveFit struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	SectorSize int64  `json:"sectorSize"`
+	// FreeRegions are the regions the new partitions can be created in,
+	// the whole drive when the partition table gets replaced
+	FreeRegions []FreeRegion `json:"freeRegions"`
+	// Available is the size of the free regions, once aligned
+	Available int64 `json:"available"`
+	// Required is the size of the partitions with a fixed size, plus 1 MiB
+	// for each partition taking the remaining space
+	Required int64 `json:"required"`
+	// Partitions are where the partitions would be created, until the first
+	// one that doesn't fit
+	Partitions []PartitionFit `json:"partitions"`
+	// Deleted are the nodes of the existing partitions the drive would delete
+	Deleted []string `json:"deleted,omitempty"`
+	// Shrinks are what shrinking the existing partitions of the drive would do
+	Shrinks []ShrinkEstimate `json:"shrinks,omitempty"`
+	Fits    bool             `json:"fits"`
+	// Problem explains why the partitions don't fit
+	Problem string `json:"problem,omitempty"`
+}
+
+// FreeRegion represents a region of a drive without any partition
+type FreeRegion struct {
+	Start int64 `json:"start"`
+	Size  int64 `json:"size"`
+}
+
+// PartitionFit represents where a partition would be created
+type PartitionFit struct {
+	Start int64 `json:"start"`
+	Size  int64 `json:"size"`
+	// Sectors is the size in sectors, given to sfdisk for the
+	// sizes resolved from the drive size
+	Sectors int64 `json:"sectors"`
+}
+
+// Returns true if the partitions fit on every drive
+func (r *FitReport) Fits() bool {
+	for _, d := range r.Drives {
+		if !d.Fits {
+			return false
+		}
+	}
+	return true
+}
+
+// Computes where the partitions of every drive would be created, without
+// writing anything: each partition is aligned on 1 MiB and placed in the
+// first free region it fits in, like sfdisk does
+// Percentages are resolved from the drive size, or from the space remaining
+// once the previous partitions are placed, then Min and Max are applied
+// The partitions of a drive replace its partition table, unless Append is true
+// in which case only the free regions between the existing partitions are used
+// The existing partitions reused by a drive are left out, they keep their place
+// The partitions the drive deletes are found first, then the partitions it shrinks
+// are estimated (see PartitionShrink), the space they would free being used by the
+// new partitions
+//
+// It executes, for each drive:
+//
+//	blockdev --getsize64 <drive>
+//	blockdev --getss <drive>
+//	sfdisk --json <drive> (only if Append is true)
+//	blkid to find the partitions it deletes or shrinks (see PartitionReference.find)
+//	the read-only commands of the partitions it shrinks (see minimumFileSystemSize)
+//
+// Can return one type of error: SetupPartitionsError
+func Fit(r runner.Runner, drives []Drive) (*FitReport, error) {
+	var report FitReport
+	for _, drive := range drives {
+		driveFit, err := fitDrive(r, drive)
+		if err != nil {
+			return nil, err
+		}
+		report.Drives = append(report.Drives, *driveFit)
+	}
+	return &report, nil
+}
+
+// Checks that the partitions of every drive fit on it, see Fit
+// Adds a problem to the report for every drive they don't fit on, path
+// being the JSON path of the drives
+func CheckFit(r runner.Runner, path string, drives []Drive, report *validation.Report) {
+	fitReport, err := Fit(r, drives)
+	if err != nil {
+		report.Add(path, validation.CodeCheckFailed, err.Error())
+		return
+	}
+
+	for i, d := range fitReport.Drives {
+		if !d.Fits {
+			report.Add(validation.Field(validation.Index(path, i), "partitions"), validation.CodeOutOfRange, d.Problem)
+		}
+	}
+}
+
+// Computes where the partitions of the drive would be created
+//
+// Can return one type of error: SetupPartitionsError
+func fitDrive(r runner.Runner, drive Drive) (*DriveFit, error) {
+	size, err := queryBlockdev(r, "--getsize64", drive.Path)
+	if err != nil {
+		return nil, err
+	}
+	sectorSize, err := queryBlockdev(r, "--getss", drive.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	fit := &DriveFit{
+		Path:       drive.Path,
+		Size:       size,
+		SectorSize: sectorSize,
+	}
+
+	shrinkProblem := ""
+	if drive.Append {
+		state, err := getDriveStateWithSfdisk(r, drive.Path)
+		if err != nil {
+			return nil, err
+		}
+		fit.Deleted, err = findDeletedPartitions(r, drive, state)
+		if err != nil {
+			return nil, err
+		}
+		if len(drive.Shrink) > 0 {
+			tableSectorSize := state.PartitionTable.SectorSize
+			if tableSectorSize == 0 {
+				tableSectorSize = sectorSize
+			}
+			fit.Shrinks, shrinkProblem, err = estimateShrinks(r, drive, state, tableSectorSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+		table := state.PartitionTable
+		if table.Label == partitionTableDos {
+			// sfdisk doesn't give the usable sectors of a DOS partition table
+			table.FirstLba = partitionAlignment / sectorSize
+			table.LastLba = min(size/sectorSize, dosMaxSectors) - 1
+		}
+		fit.FreeRegions = freeRegions(table, sectorSize)
+	} else {
+		// A new GPT is written: the first MiB holds the primary GPT
+		// and the end of the drive its backup
+		// A new DOS partition table only needs the first sector
+		end := size - gptEntriesSize - sectorSize
+		if drive.partitionTable() == partitionTableDos {
+			end = min(size, dosMaxSectors*sectorSize)
+		}
+		if end > partitionAlignment {
+			fit.FreeRegions = []FreeRegion{{Start: partitionAlignment, Size: end - partitionAlignment}}
+		}
+	}
+
+	fit.Available = freeSpace(fit.FreeRegions)
+	fit.place(drive.newPartitions())
+	if shrinkProblem != "" {
+		fit.fail(shrinkProblem)
+	}
+	return fit, nil
+}
+
+// Places the partitions in the free regions, in order, and sets Required,
+// Partitions, Fits and Problem
+// Percentages and Min/Max bounds are resolved here, once the drive size is known
+func (fit *DriveFit) place(partitions []Partition) {
+	regions := make([]FreeRegion, len(fit.FreeRegions))
+	copy(regions, fit.FreeRegions)
+
+	fit.Fits = true
+	for i, p := range partitions {
+		minimum, maximum := p.Size.bounds()
+		minimum = alignUp(minimum, fit.SectorSize)
+		maximum = maximum / fit.SectorSize * fit.SectorSize
+
+		var size int64
+		if p.Size.TakeRemaining {
+			fit.Required += max(minimum, partitionAlignment)
+		} else {
+			wanted, ok := p.Size.wanted(fit.Size, freeSpace(regions))
+			if !ok {
+				fit.fail(fmt.Sprintf("partition %d of '%s' is too big", i+1, fit.Path))
+				return
+			}
+			size = alignUp(wanted, fit.SectorSize)
+			if maximum != 0 {
+				size = min(size, maximum)
+			}
+			size = max(size, minimum, fit.SectorSize)
+			fit.Required += size
+		}
+
+		placed := false
+		for j := range regions {
+			start := alignUp(regions[j].Start, partitionAlignment)
+			end := regions[j].Start + regions[j].Size
+			if p.Size.TakeRemaining {
+				size = (end - start) / fit.SectorSize * fit.SectorSize
+				if maximum != 0 {
+					size = min(size, maximum)
+				}
+				if size < max(minimum, partitionAlignment) {
+					continue
+				}
+			} else if start+size > end {
+				continue
+			}
+
+			fit.Partitions = append(fit.Partitions, PartitionFit{Start: start, Size: size, Sectors: size / fit.SectorSize})
+			regions[j] = FreeRegion{Start: start + size, Size: end - start - size}
+			placed = true
+			break
+		}
+
+		if !placed && fit.Fits {
+			fit.fail(fmt.Sprintf("partition %d of '%s' doesn't fit", i+1, fit.Path))
+		}
+	}
+
+	if !fit.Fits {
+		fit.Problem += fmt.Sprintf(": %d bytes are required but %d bytes are available", fit.Required, fit.Available)
+	}
+}
+
+// Returns the size of the free regions, once aligned
+func freeSpace(regions []FreeRegion) int64 {
+	var free int64
+	for _, region := range regions {
+		start := alignUp(region.Start, partitionAlignment)
+		if end := region.Start + region.Size; start < end {
+			free += end - start
+		}
+	}
+	return free
+}
+
+// Marks the partitions as not fitting on the drive
+func (fit *DriveFit) fail(problem string) {
+	fit.Fits = false
+	fit.Problem = problem
+}
+
+// Returns the free regions between the partitions of the partition table, in bytes
+func freeRegions(table SfdiskJsonPartitionTable, sectorSize int64) []FreeRegion {
+	if table.SectorSize != 0 {
+		sectorSize = table.SectorSize
+	}
+
+	var regions []FreeRegion
+	start := table.FirstLba
+	partitions := slices.SortedFunc(slices.Values(table.Partitions), func(a, b SfdiskJsonPartition) int {
+		return cmp.Compare(a.Start, b.Start)
+	})
+	for _, p := range partitions {
+		if p.Start > start {
+			regions = append(regions, FreeRegion{Start: start * sectorSize, Size: (p.Start - start) * sectorSize})
+		}
+		start = max(start, p.Start+p.Size)
+	}
+	if end := table.LastLba + 1; end > start {
+		regions = append(regions, FreeRegion{Start: start * sectorSize, Size: (end - start) * sectorSize})
+	}
+
+	return regions
+}
+
+// Returns the value rounded up to a multiple of alignment
+func alignUp(value, alignment int64) int64 {
+	if remainder := value % alignment; remainder != 0 {
+		return value + alignment - remainder
+	}
+	return value
+}
+
+// Returns the number printed by 'blockdev <option> <drive>'
+//
+// Can return one type of error: SetupPartitionsError
+func queryBlockdev(r runner.Runner, option, drive string) (int64, error) {
+	result, err := r.Query(runner.Command("blockdev", option, drive))
+	if err != nil {
+		return 0, &SetupPartitionsError{
+			Err: fmt.Errorf("error getting the size of drive '%s': error=%s", drive, err.Error()),
+		}
+	}
+
+	value, err := strconv.ParseInt(strings.TrimSpace(result.Stdout), 10, 64)
+	if err != nil || value <= 0 {
+		return 0, &SetupPartitionsError{
+			Err: fmt.Errorf("error getting the size of drive '%s': unexpected blockdev output '%s'", drive, strings.TrimSpace(result.Stdout)),
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,210 @@
+package partition
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+// Absolute path of the fstab file of the new install
+const fstabFile string = "/mnt/etc/fstab"
+
+// Options of the EFI system partition, only root can read it, unless
+// its MountOptions set them
+var efiMountOptions []string = []string{"fmask=0077", "dmask=0077"}
+
+// Mount options choosing how the access times of the files are updated
+var atimeMountOptions []string = []string{"atime", "noatime", "relatime", "strictatime"}
+
+// FstabEntry represents one line of /etc/fstab
+type FstabEntry struct {
+	Source     string
+	MountPoint string
+	FileSystem string
+	Options    string
+	Dump       int
+	Pass       int
+}
+
+// Returns the entry in the fstab format
+//
+// Example:
+// "UUID=0a3407de-014b-458b-b5c1-848e92a327a3	/	ext4	rw,relatime	0 1"
+func (e FstabEntry) String() string {
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%d %d", e.Source, e.MountPoint, e.FileSystem, e.Options, e.Dump, e.Pass)
+}
+
+// Writes the fstab of the new install from the Layout, the partitions
+// need to be formatted and the base system installed
+//
+// Can return one type of error: SetupPartitionsError
+func WriteFstab(r runner.Runner, layout Layout) error {
+	entries, err := FstabEntries(r, layout)
+	if err != nil {
+		return err
+	}
+
+	var content strings.Builder
+	content.WriteString("# /etc/fstab: static file system information, generated by october-installer\n")
+	content.WriteString("#\n# <file system>\t<dir>\t<type>\t<options>\t<dump> <pass>\n\n")
+	for _, entry := range entries {
+		content.WriteString(entry.String() + "\n")
+	}
+
+	if err := r.WriteFile(fstabFile, []byte(content.String())); err != nil {
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("error writing '%s': error=%s", fstabFile, err.Error()),
+		}
+	}
+	return nil
+}
+
+// Returns the fstab entries of every mounted partition of the Layout, referenced
+// by their file system UUID, or by their PARTUUID when they don't have one
+// The entries are in the order planned by PlanMounts
+//
+// Can return one type of error: SetupPartitionsError
+func FstabEntries(r runner.Runner, layout Layout) ([]FstabEntry, error) {
+	mounts, err := PlanMounts(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []FstabEntry
+	for _, m := range mounts {
+		source, err := fstabSource(r, m.Node)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err := m.fstabEntry(source)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Returns the fstab entry of the mount, source being how the partition is referenced
+//
+// Can return one type of error: SetupPartitionsError
+func (m Mount) fstabEntry(source string) (FstabEntry, error) {
+	entry := FstabEntry{
+		Source:     source,
+		MountPoint: m.MountPoint,
+		FileSystem: m.Partition.fileSystem(),
+		Options:    m.fstabOptions(),
+	}
+
+	switch m.Partition.PartitionType {
+	case gptPartitionTypeEfi:
+		entry.Pass = 2
+	case gptPartitionTypeSwap:
+	case gptPartitionTypeRoot, gptPartitionTypeHome, gptPartitionTypeFileSystem, gptPartitionTypeBasicData:
+		switch m.Partition.FileSystem {
+		case fileSystemExt4, fileSystemF2fs, fileSystemVfat, fileSystemExfat:
+			entry.Pass = 2
+			if entry.MountPoint == "/" {
+				entry.Pass = 1
+			}
+		case fileSystemBtrfs, fileSystemXfs:
+			// fsck.btrfs and fsck.xfs do nothing, these file systems check themselves when mounted
+			entry.Pass = 0
+		default:
+			return entry, &SetupPartitionsError{
+				Err: fmt.Errorf("error creating the fstab entry of '%s': unsupported file system", source),
+			}
+		}
+	default:
+		return entry, &SetupPartitionsError{
+			Err: fmt.Errorf("error creating the fstab entry of '%s': unsupported partition type", source),
+		}
+	}
+
+	return entry, nil
+}
+
+// Returns the fstab options of the mount: "rw" and its Options, with
+// "relatime" unless they already choose how access times are updated,
+// and the fmask and dmask of the EFI system partition unless they are set
+// Swap partitions get their Options, or "defaults"
+//
+// Example:
+// "rw,relatime"
+// "rw,noatime,compress=zstd,subvol=/@"
+// "rw,relatime,fmask=0077,dmask=0077"
+func (m Mount) fstabOptions() string {
+	if m.Partition.IsSwap() {
+		if len(m.Options) == 0 {
+			return "defaults"
+		}
+		return strings.Join(m.Options, ",")
+	}
+
+	var options []string
+	if !hasMountOption(m.Options, "ro", "rw") {
+		options = append(options, "rw")
+	}
+	if !hasMountOption(m.Options, atimeMountOptions...) {
+		options = append(options, "relatime")
+	}
+	if m.Partition.PartitionType == gptPartitionTypeEfi {
+		for _, option := range efiMountOptions {
+			name, _, _ := strings.Cut(option, "=")
+			if !hasMountOption(m.Options, name, "umask") {
+				options = append(options, option)
+			}
+		}
+	}
+	return strings.Join(append(options, m.Options...), ",")
+}
+
+// Returns true if one of the options is one of names, with or without a value
+func hasMountOption(options []string, names ...string) bool {
+	return slices.ContainsFunc(options, func(option string) bool {
+		name, _, _ := strings.Cut(option, "=")
+		return slices.Contains(names, name)
+	})
+}
+
+// Returns how the partition at path is referenced inside fstab:
+// "UUID=<uuid>", or "PARTUUID=<partuuid>" when it has no file system UUID
+//
+// Can return one type of error: SetupPartitionsError
+func fstabSource(r runner.Runner, path string) (string, error) {
+	for _, tag := range []string{"UUID", "PARTUUID"} {
+		value, err := queryBlkid(r, tag, path)
+		if err != nil {
+			return "", err
+		}
+		if value != "" {
+			return fmt.Sprintf("%s=%s", tag, value), nil
+		}
+	}
+
+	return "", &SetupPartitionsError{
+		Err: fmt.Errorf("error getting the UUID of partition '%s': partition has no UUID nor PARTUUID", path),
+	}
+}
+
+// Returns the value of the tag of the device at path, e.g. its UUID, or an
+// empty string if the device doesn't have the tag
+// The blkid cache is bypassed since the devices were just created
+//
+// It executes:
+//
+//	blkid --cache-file /dev/null --match-tag <tag> --output value <path>
+//
+// Can return one type of error: SetupPartitionsError
+func queryBlkid(r runner.Runner, tag, path string) (string, error) {
+	result, err := r.Query(runner.Command("blkid", "--cache-file", "/dev/null", "--match-tag", tag, "--output", "value", path))
+	if err != nil && result.ExitCode != 2 { // 2: the tag wasn't found
+		return "", &SetupPartitionsError{
+			Err: fmt.Errorf("error getting the %s of partition '%s': error=%s", tag, path, err.Error()),
+		}
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
@@ -0,0 +1,306 @@
+package partition
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/firmware"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+// Validates the partitions of every drive and the volume groups together for the firmware
+// Returns a ValidationError wrapping a validation.Report listing
+// every problem if validation fails
+func ValidateLayout(drives []Drive, volumeGroups []VolumeGroup, mode firmware.Mode) error {
+	var report validation.Report
+	CheckLayout("", drives, volumeGroups, mode, &report)
+	if !report.Valid() {
+		return &ValidationError{
+			Err: report.Err(),
+		}
+	}
+	return nil
+}
+
+// Checks the partitions of every drive and the volume groups together, the checks
+// needing a single partition or volume group being done by Drive.Check and VolumeGroup.Check:
+// - a drive path can only be used once
+// - a partition taking the remaining space must be the last of its drive
+// - a partition Id can only be used once
+// - an existing partition can only be reused once
+// - a mount point can only be used once, by a partition or a logical volume
+// - a file system Uuid can only be used once, by a partition or a logical volume
+// - exactly one partition or logical volume must be mounted at '/', and it can't be the EFI system partition
+// - a volume group name can only be used once
+// - the physical volumes of a volume group must be Linux LVM partitions referenced by their Id,
+// each one used by a single volume group, and every Linux LVM partition must be used
+// - a root logical volume needs a separate /boot partition, Grub loading the kernels from a partition
+// - on UEFI, exactly one EFI system partition must be defined, Grub is installed on it
+// - the mapped devices of the encrypted partitions must have different names
+// - the encrypted root partition, and the encrypted physical volumes of the volume group
+// holding the root logical volume, must use a passphrase, it is asked at boot
+// - the encrypted partition holding /boot (or /) must use LUKS1, Grub unlocks it
+// - on BIOS, at most one EFI system partition can be defined, and the GPT drive holding
+// /boot (or / when /boot isn't a separate partition) needs a BIOS boot partition, Grub
+// being installed on that drive; an existing one is expected when appending
+//
+// Adds every problem found to the report, path being the JSON path holding the
+// "drives" and "volumeGroups" fields, the problems of the whole layout being
+// reported on the drives
+func CheckLayout(path string, drives []Drive, volumeGroups []VolumeGroup, mode firmware.Mode, report *validation.Report) {
+	drivesPath := validation.Field(path, "drives")
+	// JSON path of the drive using each path
+	drivePaths := make(map[string]string)
+	// JSON path of the partition or logical volume using each mount point
+	mountPoints := make(map[string]string)
+	var efiPartitions []string
+	// JSON path of the partition using each mapped device name
+	mapperNames := make(map[string]string)
+	// JSON path of the partition using each Id
+	ids := make(map[string]string)
+	// JSON path of the partition reusing each existing partition, by drive and reference
+	existing := make(map[string]string)
+	// JSON path of each Linux LVM partition
+	var lvmPartitions []string
+	// Linux LVM partition using each Id
+	lvmIds := make(map[string]Partition)
+	bootDrive, bootPartition := findBootPartition(drives)
+
+	for i, drive := range drives {
+		drivePath := validation.Index(drivesPath, i)
+		if other, found := drivePaths[drive.Path]; found {
+			report.Add(validation.Field(drivePath, "path"), validation.CodeInvalid, fmt.Sprintf("Drive '%s' is already defined by %s", drive.Path, other))
+		} else {
+			drivePaths[drive.Path] = drivePath
+		}
+
+		partitionsPath := validation.Field(drivePath, "partitions")
+		for j, p := range drive.Partitions {
+			partitionPath := validation.Index(partitionsPath, j)
+
+			if p.Size.TakeRemaining && j != len(drive.Partitions)-1 {
+				report.Add(validation.Field(validation.Field(partitionPath, "size"), "takeRemaining"), validation.CodeInvalid, "Only the last partition of a drive can take the remaining space")
+			}
+
+			if p.Existing != nil {
+				key := drive.Path + " " + p.Existing.String()
+				if other, found := existing[key]; found {
+					report.Add(validation.Field(partitionPath, "existing"), validation.CodeInvalid, fmt.Sprintf("Existing partition '%s' is already reused by %s", p.Existing, other))
+				} else {
+					existing[key] = partitionPath
+				}
+			}
+
+			if p.PartitionType == gptPartitionTypeEfi {
+				efiPartitions = append(efiPartitions, partitionPath)
+			}
+
+			if p.IsLvm() {
+				lvmPartitions = append(lvmPartitions, partitionPath)
+			}
+			if p.Id != "" {
+				if other, found := ids[p.Id]; found {
+					report.Add(validation.Field(partitionPath, "id"), validation.CodeInvalid, fmt.Sprintf("Id '%s' is already used by %s", p.Id, other))
+				} else {
+					ids[p.Id] = partitionPath
+					if p.IsLvm() {
+						lvmIds[p.Id] = p
+					}
+				}
+			}
+
+			if name := p.mapperName(); name != "" {
+				if other, found := mapperNames[name]; found {
+					report.Add(validation.Field(validation.Field(partitionPath, "encryption"), "label"), validation.CodeInvalid, fmt.Sprintf("The mapped device name '%s' is already used by %s, set a different Label", name, other))
+				} else {
+					mapperNames[name] = partitionPath
+				}
+			}
+
+			if p.IsSwap() {
+				continue
+			}
+
+			for _, m := range p.mountPoints(partitionPath) {
+				if other, found := mountPoints[m.mountPoint]; found {
+					report.Add(m.path, validation.CodeInvalid, fmt.Sprintf("MountPoint '%s' is already used by %s", m.mountPoint, other))
+					continue
+				}
+				mountPoints[m.mountPoint] = m.path
+
+				if m.mountPoint == "/" && p.PartitionType == gptPartitionTypeEfi {
+					report.Add(m.path, validation.CodeInvalid, "The EFI system partition can't be mounted at '/'")
+				}
+			}
+
+			if isRoot(p) && p.Encryption != nil && p.Encryption.KeyFile != "" {
+				report.Add(validation.Field(validation.Field(partitionPath, "encryption"), "keyFile"), validation.CodeInvalid, "The root partition must be encrypted with a Passphrase, it is asked at boot")
+			}
+			if i == bootDrive && j == bootPartition && p.Encryption != nil && p.Encryption.version() != luksVersion1 {
+				report.Add(validation.Field(validation.Field(partitionPath, "encryption"), "version"), validation.CodeInvalid, fmt.Sprintf("The partition holding /boot must be encrypted with %s, Grub needs to unlock it", luksVersion1))
+			}
+		}
+	}
+
+	checkUuids(path, drives, volumeGroups, report)
+	rootVolumeGroup := checkVolumeGroups(validation.Field(path, "volumeGroups"), volumeGroups, ids, lvmIds, mountPoints, report)
+	// JSON path of the partition of each physical volume
+	physicalVolumes := make(map[string]string)
+	for _, vg := range volumeGroups {
+		for _, id := range vg.PhysicalVolumes {
+			if _, isLvm := lvmIds[id]; isLvm {
+				physicalVolumes[ids[id]] = id
+			}
+		}
+	}
+	for _, partitionPath := range lvmPartitions {
+		id, used := physicalVolumes[partitionPath]
+		if !used {
+			report.Add(validation.Field(partitionPath, "partitionType"), validation.CodeInvalid, "The Linux LVM partition isn't used by a volume group, reference its Id in the PhysicalVolumes of one")
+			continue
+		}
+		e := lvmIds[id].Encryption
+		if rootVolumeGroup != nil && slices.Contains(rootVolumeGroup.PhysicalVolumes, id) && e != nil && e.KeyFile != "" {
+			report.Add(validation.Field(validation.Field(partitionPath, "encryption"), "keyFile"), validation.CodeInvalid, fmt.Sprintf("The physical volumes of volume group '%s' holding / must be encrypted with a Passphrase, it is asked at boot", rootVolumeGroup.Name))
+		}
+	}
+
+	if len(drives) == 0 {
+		return
+	}
+
+	if _, found := mountPoints["/"]; !found {
+		report.Add(drivesPath, validation.CodeRequired, "A partition must be mounted at '/'")
+	}
+	if rootVolumeGroup != nil {
+		if _, found := mountPoints[bootMountPoint]; !found {
+			report.Add(drivesPath, validation.CodeRequired, fmt.Sprintf("A partition must be mounted at /boot when / is a logical volume of volume group '%s', Grub loads the kernels from it", rootVolumeGroup.Name))
+		}
+	}
+
+	if mode == firmware.Bios && bootDrive >= 0 {
+		drive := drives[bootDrive]
+		needsBiosBoot := drive.partitionTable() == partitionTableGpt && !drive.Append
+		if needsBiosBoot && !slices.ContainsFunc(drive.Partitions, func(p Partition) bool { return p.IsBiosBoot() }) {
+			report.Add(validation.Field(validation.Index(drivesPath, bootDrive), "partitions"), validation.CodeRequired, fmt.Sprintf("The machine was booted with a BIOS, drive '%s' holding /boot needs a BIOS boot partition for Grub", drive.Path))
+		}
+	}
+
+	switch {
+	case len(efiPartitions) == 0 && mode == firmware.Uefi:
+		report.Add(drivesPath, validation.CodeRequired, "An EFI system partition must be defined")
+	case len(efiPartitions) > 1:
+		for _, partitionPath := range efiPartitions[1:] {
+			report.Add(validation.Field(partitionPath, "partitionType"), validation.CodeInvalid, fmt.Sprintf("Only one EFI system partition can be defined, %s already is one", efiPartitions[0]))
+		}
+	}
+}
+
+// Returns the indexes of the drive and of the partition mounted at /boot, or
+// at / when /boot isn't a separate partition, or -1 and -1 if there is none
+func findBootPartition(drives []Drive) (int, int) {
+	bootDrive, bootPartition := -1, -1
+	for i, drive := range drives {
+		j := bootPartitionIndex(drive.Partitions)
+		if j < 0 {
+			continue
+		}
+		if drive.Partitions[j].holds(bootMountPoint) {
+			return i, j
+		}
+		if bootDrive < 0 {
+			bootDrive, bootPartition = i, j
+		}
+	}
+	return bootDrive, bootPartition
+}
+
+// Checks the volume groups against the Ids of the partitions, the Linux LVM
+// partitions using each Id and the mount points of the partitions, the mount
+// points of the logical volumes being added to mountPoints
+// Returns the volume group holding the root logical volume, or nil if there is none
+func checkVolumeGroups(path string, volumeGroups []VolumeGroup, ids map[string]string, lvmIds map[string]Partition, mountPoints map[string]string, report *validation.Report) *VolumeGroup {
+	var rootVolumeGroup *VolumeGroup
+	// JSON path of the volume group using each name
+	names := make(map[string]string)
+	// JSON path of the volume group using each physical volume
+	physicalVolumes := make(map[string]string)
+
+	for i := range volumeGroups {
+		vg := &volumeGroups[i]
+		vgPath := validation.Index(path, i)
+		vg.Check(vgPath, report)
+
+		if other, found := names[vg.Name]; found {
+			report.Add(validation.Field(vgPath, "name"), validation.CodeInvalid, fmt.Sprintf("Volume group '%s' is already defined by %s", vg.Name, other))
+		} else {
+			names[vg.Name] = vgPath
+		}
+
+		for j, id := range vg.PhysicalVolumes {
+			pvPath := validation.Index(validation.Field(vgPath, "physicalVolumes"), j)
+			if other, found := physicalVolumes[id]; found {
+				report.Add(pvPath, validation.CodeInvalid, fmt.Sprintf("Partition '%s' is already a physical volume of %s", id, other))
+				continue
+			}
+			physicalVolumes[id] = vgPath
+
+			partitionPath, found := ids[id]
+			_, isLvm := lvmIds[id]
+			switch {
+			case !found:
+				report.Add(pvPath, validation.CodeInvalid, fmt.Sprintf("No partition has the Id '%s'", id))
+			case !isLvm:
+				report.Add(pvPath, validation.CodeInvalid, fmt.Sprintf("Partition '%s' (%s) must have the Linux LVM partition type to be a physical volume", id, partitionPath))
+			}
+		}
+
+		logicalVolumesPath := validation.Field(vgPath, "logicalVolumes")
+		for j, lv := range vg.LogicalVolumes {
+			p := lv.partition()
+			for _, m := range p.mountPoints(validation.Index(logicalVolumesPath, j)) {
+				if other, found := mountPoints[m.mountPoint]; found {
+					report.Add(m.path, validation.CodeInvalid, fmt.Sprintf("MountPoint '%s' is already used by %s", m.mountPoint, other))
+					continue
+				}
+				mountPoints[m.mountPoint] = m.path
+				if m.mountPoint == "/" {
+					rootVolumeGroup = vg
+				}
+			}
+		}
+	}
+
+	return rootVolumeGroup
+}
+
+// Checks that the file system UUIDs of the partitions and logical volumes
+// are different, path being the JSON path holding the drives and volume groups
+func checkUuids(path string, drives []Drive, volumeGroups []VolumeGroup, report *validation.Report) {
+	// JSON path of the partition or logical volume using each UUID
+	uuids := make(map[string]string)
+	check := func(uuid string, itemPath string) {
+		if uuid == "" {
+			return
+		}
+		if other, found := uuids[strings.ToLower(uuid)]; found {
+			report.Add(validation.Field(itemPath, "uuid"), validation.CodeInvalid, fmt.Sprintf("Uuid '%s' is already used by %s", uuid, other))
+			return
+		}
+		uuids[strings.ToLower(uuid)] = itemPath
+	}
+
+	for i, drive := range drives {
+		partitionsPath := validation.Field(validation.Index(validation.Field(path, "drives"), i), "partitions")
+		for j, p := range drive.Partitions {
+			check(p.Uuid, validation.Index(partitionsPath, j))
+		}
+	}
+	for i, vg := range volumeGroups {
+		logicalVolumesPath := validation.Field(validation.Index(validation.Field(path, "volumeGroups"), i), "logicalVolumes")
+		for j, lv := range vg.LogicalVolumes {
+			check(lv.Uuid, validation.Index(logicalVolumesPath, j))
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package partition
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+// Package needed by the new install to activate the volume groups
+const lvmPackage string = "lvm2"
+
+// Ids of the partitions and names of the volume groups and logical volumes,
+// the volumes being found under /dev/<volume group>/<logical volume>
+var volumeNameRegexp *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+-]{0,63}$`)
+
+// VolumeGroup represents an LVM volume group created on partitions
+// Possible attributes values:
+// - Name: letters, digits and '_', '.', '+', '-', not starting with '.', '+' or '-'
+// - PhysicalVolumes: the Id of the partitions the volume group is created on,
+// they must have the Linux LVM partition type
+// - LogicalVolumes: the logical volumes created inside the volume group, in order
+type VolumeGroup struct {
+	Name            string          `json:"name"`
+	PhysicalVolumes []string        `json:"physicalVolumes"`
+	LogicalVolumes  []LogicalVolume `json:"logicalVolumes"`
+}
+
+// LogicalVolume represents an LVM logical volume, formatted and mounted like a partition
+// Possible attributes values:
+// - Name: same as the VolumeGroup Name
+// - Size: same as the Partition Size, except Min and Max; percentages are of the whole
+// volume group, or of its free space with '%FREE', and must be whole numbers
+// - FileSystem: A file system present in the supportedFileSystems slice above, or "swap"
+// - MountPoint: an absolute Linux filesystem path, or string default value for swap
+// - Subvolumes, Label, Uuid, MkfsOptions, MountOptions: same as the Partition ones
+type LogicalVolume struct {
+	Name         string        `json:"name"`
+	Size         PartitionSize `json:"size"`
+	FileSystem   string        `json:"fileSystem"`
+	MountPoint   string        `json:"mountPoint"`
+	Subvolumes   []Subvolume   `json:"subvolumes,omitempty"`
+	Label        string        `json:"label,omitempty"`
+	Uuid         string        `json:"uuid,omitempty"`
+	MkfsOptions  []string      `json:"mkfsOptions,omitempty"`
+	MountOptions []string      `json:"mountOptions,omitempty"`
+}
+
+// Checks the attributes of a VolumeGroup struct and its logical volumes
+// The physical volumes are checked against the partitions by CheckLayout
+// Adds every problem found to the report, path being the JSON path of the volume group
+func (vg *VolumeGroup) Check(path string, report *validation.Report) {
+	if !volumeNameRegexp.MatchString(vg.Name) {
+		report.Add(validation.Field(path, "name"), validation.CodeInvalidFormat, "Name is in the wrong format: should be letters, digits, '_', '.', '+' or '-'")
+	}
+	if len(vg.PhysicalVolumes) == 0 {
+		report.Add(validation.Field(path, "physicalVolumes"), validation.CodeRequired, "At least one physical volume must be defined")
+	}
+	if len(vg.LogicalVolumes) == 0 {
+		report.Add(validation.Field(path, "logicalVolumes"), validation.CodeRequired, "At least one logical volume must be defined")
+	}
+
+	logicalVolumesPath := validation.Field(path, "logicalVolumes")
+	for i := range vg.LogicalVolumes {
+		lv := &vg.LogicalVolumes[i]
+		lvPath := validation.Index(logicalVolumesPath, i)
+		lv.Check(lvPath, report)
+
+		if slices.ContainsFunc(vg.LogicalVolumes[:i], func(other LogicalVolume) bool { return other.Name == lv.Name }) {
+			report.Add(validation.Field(lvPath, "name"), validation.CodeInvalid, fmt.Sprintf("Logical volume '%s' is already defined in volume group '%s'", lv.Name, vg.Name))
+		}
+		if lv.Size.TakeRemaining && i != len(vg.LogicalVolumes)-1 {
+			report.Add(validation.Field(validation.Field(lvPath, "size"), "takeRemaining"), validation.CodeInvalid, "Only the last logical volume of a volume group can take the remaining space")
+		}
+	}
+}
+
+// Checks the attributes of a LogicalVolume struct
+// Adds every problem found to the report, path being the JSON path of the logical volume
+func (lv *LogicalVolume) Check(path string, report *validation.Report) {
+	if !volumeNameRegexp.MatchString(lv.Name) {
+		report.Add(validation.Field(path, "name"), validation.CodeInvalidFormat, "Name is in the wrong format: should be letters, digits, '_', '.', '+' or '-'")
+	}
+
+	if lv.FileSystem != fileSystemSwap && !slices.Contains(supportedFileSystems, lv.FileSystem) {
+		report.Add(validation.Field(path, "fileSystem"), validation.CodeUnsupported, "specified FileSystem is not supported")
+	}
+
+	checkSubvolumes(path, lv.Subvolumes, lv.FileSystem, lv.MountPoint, report)
+	switch {
+	case lv.FileSystem == fileSystemSwap:
+		if lv.MountPoint != "" {
+			report.Add(validation.Field(path, "mountPoint"), validation.CodeInvalid, "A swap logical volume isn't mounted, it can't have a MountPoint")
+		}
+	case len(lv.Subvolumes) > 0:
+		// The subvolumes are mounted instead
+	case lv.MountPoint == "":
+		report.Add(validation.Field(path, "mountPoint"), validation.CodeRequired, "MountPoint is not defined, but the logical volume needs a mount point")
+	case !filepath.IsAbs(lv.MountPoint):
+		report.Add(validation.Field(path, "mountPoint"), validation.CodeInvalidFormat, "MountPoint is in the wrong format: should start by '/'")
+	}
+	p := lv.partition()
+	p.checkFormatOptions(path, report)
+	p.checkSharedFileSystem(path, report)
+	for _, m := range p.mountPoints(path) {
+		if m.mountPoint == bootMountPoint {
+			report.Add(m.path, validation.CodeInvalid, "/boot can't be a logical volume, Grub loads the kernels from a partition")
+		}
+	}
+
+	sizePath := validation.Field(path, "size")
+	lv.Size.Check(sizePath, report)
+	if lv.Size.Min != "" || lv.Size.Max != "" {
+		report.Add(sizePath, validation.CodeUnsupported, "Min and Max can't be used by a logical volume")
+	}
+	if value, err := parseSizeValue(lv.Size.Value); err == nil && value.percent != math.Trunc(value.percent) {
+		report.Add(validation.Field(sizePath, "value"), validation.CodeInvalidFormat, "The percentage of a logical volume must be a whole number")
+	}
+}
+
+// Returns the Partition the logical volume is formatted and mounted as
+func (lv *LogicalVolume) partition() Partition {
+	p := Partition{
+		Size:          lv.Size,
+		FileSystem:    lv.FileSystem,
+		PartitionType: gptPartitionTypeFileSystem,
+		MountPoint:    lv.MountPoint,
+		Subvolumes:    lv.Subvolumes,
+		Label:         lv.Label,
+		Uuid:          lv.Uuid,
+		MkfsOptions:   lv.MkfsOptions,
+		MountOptions:  lv.MountOptions,
+	}
+	if lv.FileSystem == fileSystemSwap {
+		p.FileSystem = ""
+		p.PartitionType = gptPartitionTypeSwap
+	} else if isRoot(p) {
+		p.PartitionType = gptPartitionTypeRoot
+	}
+	return p
+}
+
+// Returns the size arguments of lvcreate: '--size <bytes>b', or
+// '--extents <percent>%VG|FREE' for percentages and the remaining space
+func (lv *LogicalVolume) sizeArgs() []string {
+	if lv.Size.TakeRemaining {
+		return []string{"--extents", "100%FREE"}
+	}
+
+	if value, err := parseSizeValue(lv.Size.Value); err == nil && value.percent != 0 {
+		if value.ofFree {
+			return []string{"--extents", fmt.Sprintf("%d%%FREE", int(value.percent))}
+		}
+		return []string{"--extents", fmt.Sprintf("%d%%VG", int(value.percent))}
+	}
+
+	bytes, _ := lv.Size.Bytes()
+	return []string{"--size", fmt.Sprintf("%db", bytes)}
+}
+
+// Adds the volume groups to the Layout: the partitions they are created on
+// get their VolumeGroup set, and their logical volumes are appended to it
+// so they get formatted and mounted like partitions
+//
+// Can return one type of error: SetupPartitionsError
+func MapVolumeGroups(layout Layout, volumeGroups []VolumeGroup) (Layout, error) {
+	layout = slices.Clone(layout)
+	for _, vg := range volumeGroups {
+		for _, id := range vg.PhysicalVolumes {
+			i := slices.IndexFunc(layout, func(mapped MappedPartition) bool {
+				return mapped.LogicalVolume == nil && mapped.Partition.Id == id
+			})
+			if i < 0 {
+				return nil, &SetupPartitionsError{
+					Err: fmt.Errorf("error mapping volume group '%s': no partition has the id '%s'", vg.Name, id),
+				}
+			}
+			layout[i].VolumeGroup = vg.Name
+		}
+
+		for _, lv := range vg.LogicalVolumes {
+			layout = append(layout, MappedPartition{
+				Partition:     lv.partition(),
+				Node:          filepath.Join("/dev", vg.Name, lv.Name),
+				VolumeGroup:   vg.Name,
+				LogicalVolume: &lv,
+			})
+		}
+	}
+	return layout, nil
+}
+
+// Creates the volume groups of the Layout on their physical volumes, then
+// their logical volumes, in order
+//
+// It executes, for each volume group:
+//
+//	pvcreate --yes <device>...
+//	vgcreate --yes <volume group> <device>...
+//	lvcreate --yes --wipesignatures y --name <logical volume> --size <bytes>b|--extents <percent> <volume group>
+//
+// Can return one type of error: SetupPartitionsError
+func createVolumeGroups(r runner.Runner, layout Layout) error {
+	var names []string
+	devices := make(map[string][]string)
+	for _, mapped := range layout {
+		if mapped.VolumeGroup == "" || mapped.LogicalVolume != nil {
+			continue
+		}
+		if !slices.Contains(names, mapped.VolumeGroup) {
+			names = append(names, mapped.VolumeGroup)
+		}
+		devices[mapped.VolumeGroup] = append(devices[mapped.VolumeGroup], mapped.Device())
+	}
+
+	for _, name := range names {
+		if _, err := r.Run(runner.Command("pvcreate", append([]string{"--yes"}, devices[name]...)...)); err != nil {
+			return &SetupPartitionsError{
+				Err: fmt.Errorf("error creating the physical volumes of volume group '%s': error=%s", name, err.Error()),
+			}
+		}
+		if _, err := r.Run(runner.Command("vgcreate", append([]string{"--yes", name}, devices[name]...)...)); err != nil {
+			return &SetupPartitionsError{
+				Err: fmt.Errorf("error creating volume group '%s': error=%s", name, err.Error()),
+			}
+		}
+
+		for _, mapped := range layout {
+			lv := mapped.LogicalVolume
+			if lv == nil || mapped.VolumeGroup != name {
+				continue
+			}
+			args := append([]string{"--yes", "--wipesignatures", "y", "--name", lv.Name}, lv.sizeArgs()...)
+			if _, err := r.Run(runner.Command("lvcreate", append(args, name)...)); err != nil {
+				return &SetupPartitionsError{
+					Err: fmt.Errorf("error creating logical volume '%s' in volume group '%s': error=%s", lv.Name, name, err.Error()),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Activates the volume groups of the Layout, e.g. after a reboot
+//
+// It executes, for each volume group:
+//
+//	vgchange --activate y <volume group>
+//
+// Can return one type of error: SetupPartitionsError
+func activateVolumeGroups(r runner.Runner, layout Layout) error {
+	var activated []string
+	for _, mapped := range layout {
+		if mapped.LogicalVolume == nil || slices.Contains(activated, mapped.VolumeGroup) {
+			continue
+		}
+		if _, err := r.Run(runner.Command("vgchange", "--activate", "y", mapped.VolumeGroup)); err != nil {
+			return &SetupPartitionsError{
+				Err: fmt.Errorf("error activating volume group '%s': error=%s", mapped.VolumeGroup, err.Error()),
+			}
+		}
+		activated = append(activated, mapped.VolumeGroup)
+	}
+	return nil
+}
+
+// Returns true if the Layout has at least one volume group
+func (l Layout) HasVolumeGroups() bool {
+	return slices.ContainsFunc(l, func(mapped MappedPartition) bool {
+		return mapped.VolumeGroup != ""
+	})
+}
+
+// Returns the packages the new install needs to use the Layout, e.g.
+// lvm2 to activate its volume groups and xfsprogs to check its xfs
+// file systems, none when it only has ext4 and swap partitions
+func (l Layout) Packages() []string {
+	var packages []string
+	if l.HasVolumeGroups() {
+		packages = append(packages, lvmPackage)
+	}
+	for _, mapped := range l {
+		if !mapped.Partition.needsFormatting() {
+			continue
+		}
+		p, found := fileSystemPackages[mapped.Partition.fileSystem()]
+		if found && !slices.Contains(packages, p) {
+			packages = append(packages, p)
+		}
+	}
+	return packages
+}
@@ -0,0 +1,129 @@
+package partition
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+// Directory the new install is mounted on inside the live system
+const targetRoot string = "/mnt"
+
+// Mount point of the swap partitions inside fstab, they aren't mounted on a directory
+const swapMountPoint string = "none"
+
+// Mount represents a partition of the Layout and where it gets mounted
+type Mount struct {
+	Partition Partition
+	// Node is the device that gets mounted, the mapped device of an encrypted partition
+	Node string
+	// MountPoint is where the partition is mounted inside the new install,
+	// "none" for swap partitions
+	MountPoint string
+	// Target is where the partition is mounted on the live system, under /mnt,
+	// empty for swap partitions
+	Target string
+	// Options are the options given to mount, or swapon for swap partitions: the
+	// MountOptions of the partition, then the ones of the subvolume being mounted
+	Options []string
+}
+
+// Plans the mounts of every partition of the Layout: each MountPoint is resolved
+// under /mnt and the mounts are sorted by depth so a parent is always mounted before
+// its children, e.g. / then /boot then /boot/efi
+// Swap partitions come last, partitions without a MountPoint aren't mounted
+// The subvolumes of a btrfs partition are mounted instead of the partition
+//
+// Can return one type of error: SetupPartitionsError
+func PlanMounts(layout Layout) ([]Mount, error) {
+	var mounts []Mount
+	var swaps []Mount
+	hasRoot := false
+
+	for _, mapped := range layout {
+		if mapped.Partition.IsSwap() {
+			swaps = append(swaps, Mount{
+				Partition:  mapped.Partition,
+				Node:       mapped.Device(),
+				MountPoint: swapMountPoint,
+				Options:    mapped.Partition.MountOptions,
+			})
+			continue
+		}
+
+		options := mapped.Partition.MountOptions
+		candidates := []Mount{{MountPoint: mapped.Partition.MountPoint, Options: options}}
+		for _, s := range mapped.Partition.Subvolumes {
+			candidates = append(candidates, Mount{
+				MountPoint: s.MountPoint,
+				Options:    append(slices.Clone(options), s.mountOptions()...),
+			})
+		}
+
+		for _, candidate := range candidates {
+			if candidate.MountPoint == "" {
+				continue
+			}
+
+			if !filepath.IsAbs(candidate.MountPoint) {
+				return nil, &SetupPartitionsError{
+					Err: fmt.Errorf("error planning the mount of partition '%s': mount point '%s' is not absolute", mapped.Node, candidate.MountPoint),
+				}
+			}
+			mountPoint := filepath.Clean(candidate.MountPoint)
+
+			if i := slices.IndexFunc(mounts, func(m Mount) bool { return m.MountPoint == mountPoint }); i >= 0 {
+				return nil, &SetupPartitionsError{
+					Err: fmt.Errorf("error planning the mount of partition '%s': '%s' is already the mount point of partition '%s'", mapped.Node, mountPoint, mounts[i].Node),
+				}
+			}
+			if mountPoint == "/" {
+				hasRoot = true
+			}
+
+			mounts = append(mounts, Mount{
+				Partition:  mapped.Partition,
+				Node:       mapped.Device(),
+				MountPoint: mountPoint,
+				Target:     filepath.Join(targetRoot, mountPoint),
+				Options:    candidate.Options,
+			})
+		}
+	}
+
+	if len(mounts) > 0 && !hasRoot {
+		return nil, &SetupPartitionsError{
+			Err: fmt.Errorf("error planning the mounts: no partition is mounted at '/'"),
+		}
+	}
+
+	slices.SortStableFunc(mounts, func(a, b Mount) int {
+		return mountPointDepth(a.MountPoint) - mountPointDepth(b.MountPoint)
+	})
+	return append(mounts, swaps...), nil
+}
+
+// Returns the command mounting the partition, or enabling it for swap partitions
+func (m Mount) command() runner.Cmd {
+	if m.Partition.IsSwap() {
+		if len(m.Options) > 0 {
+			return runner.Command("swapon", "--options", strings.Join(m.Options, ","), m.Node)
+		}
+		return runner.Command("swapon", m.Node)
+	}
+	if len(m.Options) > 0 {
+		return runner.Command("mount", "--mkdir", "-o", strings.Join(m.Options, ","), m.Node, m.Target)
+	}
+	return runner.Command("mount", "--mkdir", m.Node, m.Target)
+}
+
+// Returns the number of directories of a clean absolute mount point, 0 for "/"
+func mountPointDepth(mountPoint string) int {
+	if mountPoint == "/" {
+		return 0
+	}
+	return strings.Count(mountPoint, "/")
+}
@@ -0,0 +1,260 @@
+package partition
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+// mkfsCommand represents the command formatting a file system
+type mkfsCommand struct {
+	name string
+	// args are given before the options of the partition, e.g. the flag
+	// formatting over an existing signature instead of refusing or prompting
+	args      []string
+	labelFlag string
+	// uuidFlag is empty when the UUID of the file system can't be chosen
+	uuidFlag string
+	// uuidPrefix is written before the UUID, e.g. "uuid=" for xfs
+	uuidPrefix string
+}
+
+// Command formatting each file system
+var mkfsCommands map[string]mkfsCommand = map[string]mkfsCommand{
+	fileSystemExt4:  {name: "mkfs.ext4", args: []string{"-F"}, labelFlag: "-L", uuidFlag: "-U"},
+	fileSystemBtrfs: {name: "mkfs.btrfs", args: []string{"-f"}, labelFlag: "-L", uuidFlag: "-U"},
+	fileSystemXfs:   {name: "mkfs.xfs", args: []string{"-f"}, labelFlag: "-L", uuidFlag: "-m", uuidPrefix: "uuid="},
+	fileSystemF2fs:  {name: "mkfs.f2fs", args: []string{"-f"}, labelFlag: "-l", uuidFlag: "-U"},
+	fileSystemVfat:  {name: "mkfs.fat", args: []string{"-F", "32"}, labelFlag: "-n", uuidFlag: "-i"},
+	fileSystemExfat: {name: "mkfs.exfat", labelFlag: "-L"},
+	fileSystemSwap:  {name: "mkswap", labelFlag: "-L", uuidFlag: "-U"},
+}
+
+// Options given to the mkfs command of each file system through MkfsOptions,
+// true when the option takes a value
+// The label, the UUID, the FAT size and the force flags are set by the installer
+var supportedMkfsOptions map[string]map[string]bool = map[string]map[string]bool{
+	fileSystemExt4: {
+		"-b": true, // block size
+		"-i": true, // bytes per inode
+		"-I": true, // inode size
+		"-m": true, // reserved blocks percentage
+		"-N": true, // number of inodes
+		"-E": true, // extended options, e.g. "lazy_itable_init=0"
+		"-O": true, // features, e.g. "^has_journal"
+		"-T": true, // usage type, e.g. "largefile"
+	},
+	fileSystemBtrfs: {
+		"--nodesize":   true,
+		"--sectorsize": true,
+		"--csum":       true, // checksum algorithm, e.g. "xxhash"
+		"--data":       true, // data profile, e.g. "single"
+		"--metadata":   true, // metadata profile, e.g. "dup"
+		"--features":   true, // e.g. "block-group-tree"
+		"--nodiscard":  false,
+		"--mixed":      false,
+	},
+	fileSystemXfs: {
+		"-b": true, // block size, e.g. "size=4096"
+		"-d": true, // data section, e.g. "agcount=4"
+		"-i": true, // inodes, e.g. "size=512"
+		"-l": true, // log section, e.g. "size=64m"
+		"-m": true, // metadata, e.g. "reflink=1"
+		"-n": true, // naming, e.g. "size=8192"
+		"-K": false,
+	},
+	fileSystemF2fs: {
+		"-O": true, // features, e.g. "extra_attr,compression"
+		"-e": true, // cold file extensions
+		"-s": true, // segments per section
+		"-z": true, // sections per zone
+		"-t": true, // discard, "0" or "1"
+		"-i": false,
+	},
+	fileSystemVfat: {
+		"-S": true, // logical sector size
+		"-s": true, // sectors per cluster
+		"-R": true, // reserved sectors
+		"-a": false,
+	},
+	fileSystemExfat: {
+		"-b":            true, // boundary alignment
+		"-c":            true, // cluster size
+		"--pack-bitmap": false,
+	},
+	fileSystemSwap: {
+		"--pagesize": true,
+		"--check":    false,
+	},
+}
+
+// Options given to mount for every file system through MountOptions
+var commonMountOptions []string = []string{
+	"ro", "rw",
+	"atime", "noatime", "relatime", "strictatime", "nodiratime", "lazytime",
+	"noexec", "nosuid", "nodev", "sync", "nofail", "noauto",
+}
+
+// Options given to mount for each file system through MountOptions, on top
+// of commonMountOptions; an option taking a value is written without it
+// The subvolume of a btrfs partition is set by the installer
+var supportedMountOptions map[string][]string = map[string][]string{
+	fileSystemExt4: {
+		"discard", "nodiscard", "commit", "errors", "data", "barrier", "nobarrier",
+		"journal_checksum", "delalloc", "nodelalloc", "stripe", "acl", "noacl", "user_xattr",
+	},
+	fileSystemBtrfs: {
+		"compress", "compress-force", "discard", "nodiscard", "autodefrag", "noautodefrag",
+		"ssd", "nossd", "space_cache", "commit", "datasum", "nodatasum", "datacow", "nodatacow",
+	},
+	fileSystemXfs: {
+		"discard", "nodiscard", "inode32", "inode64", "logbufs", "logbsize", "allocsize",
+		"largeio", "nolargeio", "noquota", "usrquota", "grpquota", "prjquota",
+	},
+	fileSystemF2fs: {
+		"discard", "nodiscard", "background_gc", "gc_merge", "nogc_merge", "checkpoint_merge",
+		"atgc", "compress_algorithm", "compress_log_size", "compress_extension", "compress_chksum",
+		"inline_xattr", "inline_data", "flush_merge", "active_logs", "mode", "age_extent_cache",
+	},
+	fileSystemVfat: {
+		"umask", "fmask", "dmask", "uid", "gid", "utf8", "shortname", "codepage", "iocharset", "flush",
+	},
+	fileSystemExfat: {
+		"umask", "fmask", "dmask", "uid", "gid", "iocharset", "discard", "errors", "allow_utime", "time_offset",
+	},
+	// swapon takes its options like fstab
+	fileSystemSwap: {
+		"pri", "discard",
+	},
+}
+
+// Maximum length of the label of each file system
+var maxLabelLengths map[string]int = map[string]int{
+	fileSystemExt4:  16,
+	fileSystemBtrfs: 255,
+	fileSystemXfs:   12,
+	fileSystemF2fs:  512,
+	fileSystemVfat:  11,
+	fileSystemExfat: 11,
+	fileSystemSwap:  16,
+}
+
+// Labels are kept to simple names so they can be used as is by mkfs and in /dev/disk/by-label
+var labelRegexp *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// FAT file systems have a volume ID instead of a UUID, e.g. "ABCD-1234"
+var (
+	uuidRegexp     *regexp.Regexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	volumeIdRegexp *regexp.Regexp = regexp.MustCompile(`^[0-9a-fA-F]{4}-[0-9a-fA-F]{4}$`)
+)
+
+// Mount options are given as is to mount, e.g. "compress=zstd:3" or "noatime"
+var mountOptionRegexp *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9_.:+/-]+(=[A-Za-z0-9_.:+/-]+)?$`)
+
+// Values of the mkfs options, e.g. "16384" or "^has_journal,metadata_csum"
+var mkfsOptionValueRegexp *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9_.,:=^+-]+$`)
+
+// Returns the file system of the partition: vfat for the EFI system
+// partition, swap for the swap partition, or its FileSystem
+func (p *Partition) fileSystem() string {
+	switch p.PartitionType {
+	case gptPartitionTypeEfi:
+		return fileSystemVfat
+	case gptPartitionTypeSwap:
+		return fileSystemSwap
+	}
+	return p.FileSystem
+}
+
+// Checks the Label, Uuid, MkfsOptions and MountOptions of a partition against
+// its file system, path being the JSON path of the partition
+func (p *Partition) checkFormatOptions(path string, report *validation.Report) {
+	fileSystem := p.fileSystem()
+	if !p.needsFormatting() || fileSystem == "" {
+		if p.Label != "" || p.Uuid != "" || len(p.MkfsOptions) > 0 || len(p.MountOptions) > 0 {
+			report.Add(path, validation.CodeInvalid, "Label, Uuid, MkfsOptions and MountOptions need a partition with a file system")
+		}
+		return
+	}
+
+	if p.Label != "" {
+		if !labelRegexp.MatchString(p.Label) {
+			report.Add(validation.Field(path, "label"), validation.CodeInvalidFormat, "Label is in the wrong format: should be letters, digits, '_', '.' or '-'")
+		} else if maxLength, found := maxLabelLengths[fileSystem]; found && len(p.Label) > maxLength {
+			report.Add(validation.Field(path, "label"), validation.CodeOutOfRange, fmt.Sprintf("Label can't be longer than %d characters on %s", maxLength, fileSystem))
+		}
+	}
+
+	if p.Uuid != "" {
+		if mkfsCommands[fileSystem].uuidFlag == "" {
+			report.Add(validation.Field(path, "uuid"), validation.CodeUnsupported, fmt.Sprintf("Uuid can't be chosen on %s", fileSystem))
+		} else if fileSystem == fileSystemVfat && !volumeIdRegexp.MatchString(p.Uuid) {
+			report.Add(validation.Field(path, "uuid"), validation.CodeInvalidFormat, "Uuid is in the wrong format: a FAT file system has a volume ID like 'ABCD-1234'")
+		} else if fileSystem != fileSystemVfat && !uuidRegexp.MatchString(p.Uuid) {
+			report.Add(validation.Field(path, "uuid"), validation.CodeInvalidFormat, "Uuid is in the wrong format: should be like '0a3407de-014b-458b-b5c1-848e92a327a3'")
+		}
+	}
+
+	mkfsOptionsPath := validation.Field(path, "mkfsOptions")
+	for i, option := range p.MkfsOptions {
+		name, value, hasValue := strings.Cut(option, "=")
+		takesValue, supported := supportedMkfsOptions[fileSystem][name]
+		switch {
+		case !supported:
+			report.Add(validation.Index(mkfsOptionsPath, i), validation.CodeUnsupported, fmt.Sprintf("mkfs option '%s' is not supported for %s", name, fileSystem))
+		case takesValue && !hasValue:
+			report.Add(validation.Index(mkfsOptionsPath, i), validation.CodeInvalidFormat, fmt.Sprintf("mkfs option '%s' needs a value, e.g. '%s=<value>'", name, name))
+		case !takesValue && hasValue:
+			report.Add(validation.Index(mkfsOptionsPath, i), validation.CodeInvalidFormat, fmt.Sprintf("mkfs option '%s' doesn't take a value", name))
+		case hasValue && !mkfsOptionValueRegexp.MatchString(value):
+			report.Add(validation.Index(mkfsOptionsPath, i), validation.CodeInvalidFormat, "mkfs option value is in the wrong format: should be letters, digits or '_', '.', ',', ':', '=', '^', '+', '-'")
+		}
+	}
+
+	checkMountOptions(validation.Field(path, "mountOptions"), fileSystem, p.MountOptions, report)
+}
+
+// Checks mount options against the options supported by fileSystem,
+// path being the JSON path of the options
+func checkMountOptions(path string, fileSystem string, options []string, report *validation.Report) {
+	for i, option := range options {
+		name, _, _ := strings.Cut(option, "=")
+		switch {
+		case !mountOptionRegexp.MatchString(option):
+			report.Add(validation.Index(path, i), validation.CodeInvalidFormat, "Mount option is in the wrong format: should be like 'noatime' or 'compress=zstd'")
+		case !slices.Contains(commonMountOptions, name) && !slices.Contains(supportedMountOptions[fileSystem], name):
+			report.Add(validation.Index(path, i), validation.CodeUnsupported, fmt.Sprintf("Mount option '%s' is not supported for %s", name, fileSystem))
+		}
+	}
+}
+
+// Returns the mkfs command formatting the partition at path with its Label, Uuid and MkfsOptions
+//
+// Example:
+// "mkfs.ext4 -F -L home -i 16384 /dev/sda3"
+func (c mkfsCommand) command(p *Partition, path string) runner.Cmd {
+	args := slices.Clone(c.args)
+	if p.Label != "" {
+		args = append(args, c.labelFlag, p.Label)
+	}
+	if p.Uuid != "" && c.uuidFlag != "" {
+		uuid := p.Uuid
+		if c.name == mkfsCommands[fileSystemVfat].name {
+			// mkfs.fat takes the volume ID without its dash
+			uuid = strings.ReplaceAll(uuid, "-", "")
+		}
+		args = append(args, c.uuidFlag, c.uuidPrefix+uuid)
+	}
+	for _, option := range p.MkfsOptions {
+		name, value, hasValue := strings.Cut(option, "=")
+		args = append(args, name)
+		if hasValue {
+			args = append(args, value)
+		}
+	}
+	return runner.Command(c.name, append(args, path)...)
+}
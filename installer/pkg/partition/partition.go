@@ -2,131 +2,272 @@ package partition
 
 import (
 	"fmt"
-	"io"
-	"os"
-	"os/exec"
+	"slices"
 	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
 )
 
 // Sets up the partitions for a list of Drive:
-// 1. Checks compatibility
+// 1. Checks compatibility and that the partitions fit
 // 2. Creates the partitions
-// 3. Formats and mounts each partition
+// 3. Formats each partition
+// 4. Mounts each partition
 //
-// Can return one type of error: SetupPartitionsError
-func SetupPartitions(drives []Drive) error {
-	if err := checkCompatibility(drives); err != nil {
+// Can return three types of error: SetupPartitionsError, PartitionTableCompatibilityError, DriveFitError
+func SetupPartitions(r runner.Runner, drives []Drive) error {
+	layout, err := CreatePartitions(r, drives)
+	if err != nil {
+		return err
+	}
+	if err = FormatPartitions(r, layout); err != nil {
 		return err
 	}
-	newPartitionsMappings, err := createPartitions(drives)
+	return MountPartitions(r, layout)
+}
+
+// Checks the compatibility of a list of Drives and that their partitions fit on them,
+// then creates their partitions
+//
+// Returns the Layout mapping each Partition to the partition created on the system
+// Can return three types of error: SetupPartitionsError, PartitionTableCompatibilityError, DriveFitError
+func CreatePartitions(r runner.Runner, drives []Drive) (Layout, error) {
+	if err := checkCompatibility(r, drives); err != nil {
+		return nil, err
+	}
+
+	fitReport, err := Fit(r, drives)
 	if err != nil {
+		return nil, err
+	}
+	if !fitReport.Fits() {
+		return nil, &DriveFitError{
+			Report: fitReport,
+		}
+	}
+
+	return createPartitions(r, drives, fitReport)
+}
+
+// Formats every partition and logical volume of the Layout, except the BIOS boot
+// and Linux LVM partitions and the existing partitions kept as they are:
+// 1. Encrypts and opens the encrypted partitions, their mapped device being used instead;
+// the kept existing ones are only opened
+// 2. Creates the volume groups and their logical volumes
+// 3. Formats each partition and logical volume, then creates its btrfs subvolumes
+//
+// Can return one type of error: SetupPartitionsError
+func FormatPartitions(r runner.Runner, layout Layout) error {
+	for _, mapped := range layout {
+		if mapped.Partition.Encryption == nil {
+			continue
+		}
+		open := encryptPartition
+		if !mapped.Partition.formats() {
+			open = openPartition
+		}
+		if err := open(r, mapped); err != nil {
+			return err
+		}
+	}
+
+	if err := createVolumeGroups(r, layout); err != nil {
 		return err
 	}
 
-	for _, mapping := range newPartitionsMappings {
-		for partition, sfdiskPartition := range mapping {
-			if err = formatPartition(partition, sfdiskPartition.Node); err != nil {
-				return err
-			}
-			if err = mountPartition(partition, sfdiskPartition.Node); err != nil {
-				return err
-			}
+	for _, mapped := range layout {
+		if !mapped.Partition.formats() {
+			continue
+		}
+		if err := formatPartition(r, mapped.Partition, mapped.Device()); err != nil {
+			return err
+		}
+		if err := createSubvolumes(r, mapped); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+// Mounts every partition of the Layout, in the order planned by PlanMounts
+//
+// Can return one type of error: SetupPartitionsError
+func MountPartitions(r runner.Runner, layout Layout) error {
+	mounts, err := PlanMounts(layout)
+	if err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		if err := mountPartition(r, m); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// Checks the compatibility of a list of Drives
-// A drive needs the GPT partition table to be compatible
+// Mounts every partition of the Layout that isn't already mounted, the encrypted
+// partitions that aren't opened anymore being opened and the volume groups
+// activated first
+// Useful to resume an installation after the mounts were lost, e.g. after a reboot
 //
 // Can return one type of error: SetupPartitionsError
-func checkCompatibility(drives []Drive) error {
-	for _, drive := range drives {
-		cmd := exec.Command("lsblk", drive.Path, "-dno", "pttype")
-		stdout, err := cmd.StdoutPipe()
+func RemountPartitions(r runner.Runner, layout Layout) error {
+	if err := reopenPartitions(r, layout); err != nil {
+		return err
+	}
+	if err := activateVolumeGroups(r, layout); err != nil {
+		return err
+	}
+
+	mounts, err := PlanMounts(layout)
+	if err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		mounted, err := isMounted(r, m)
 		if err != nil {
-			return &SetupPartitionsError{
-				Err: fmt.Errorf("error piping stdout: error=%s", err.Error()),
-			}
+			return err
 		}
-		stderr, err := cmd.StderrPipe()
-		if err != nil {
-			return &SetupPartitionsError{
-				Err: fmt.Errorf("error piping stderr: error=%s", err.Error()),
-			}
+		if mounted {
+			continue
 		}
-		if err := cmd.Start(); err != nil {
-			stderrOutput, _ := io.ReadAll(stderr)
-			return &SetupPartitionsError{
-				Err: fmt.Errorf("error getting partition table type for drive '%s': error=%s", drive.Path, string(stderrOutput)),
-			}
+		if err := mountPartition(r, m); err != nil {
+			return err
 		}
-		var stdoutOutput []byte
-		if stdoutOutput, err = io.ReadAll(stdout); err != nil {
-			return &SetupPartitionsError{
-				Err: fmt.Errorf("error reading stdout: error=%s", err.Error()),
-			}
+	}
+	return nil
+}
+
+// Checks the compatibility of a list of Drives
+// A drive needs the GPT partition table to be compatible, unless
+// it gets erased and a new GPT partition table created
+// A drive using a DOS partition table needs to have a DOS partition table,
+// or none at all when its partitions replace the partition table
+//
+// Can return two types of error: SetupPartitionsError, PartitionTableCompatibilityError
+func checkCompatibility(r runner.Runner, drives []Drive) error {
+	for _, drive := range drives {
+		if drive.EraseAndCreateGpt {
+			continue
 		}
-		if err := cmd.Wait(); err != nil {
+		result, err := r.Query(runner.Command("lsblk", drive.Path, "-dno", "pttype"))
+		if err != nil {
 			return &SetupPartitionsError{
-				Err: fmt.Errorf("error reading stdout: error=%s", err.Error()),
+				Err: fmt.Errorf("error getting partition table type for drive '%s': error=%s", drive.Path, err.Error()),
 			}
 		}
-		if string(stdoutOutput) != "gpt\n" {
-			return &PartitionTableCompatibilityError{
-				Err: fmt.Errorf("drive '%s' is not compatible: partition table must be GPT", drive.Path),
+
+		current := strings.TrimSpace(result.Stdout)
+		switch drive.partitionTable() {
+		case partitionTableGpt:
+			if current != partitionTableGpt {
+				return &PartitionTableCompatibilityError{
+					Err: fmt.Errorf("drive '%s' is not compatible: partition table must be GPT, set eraseAndCreateGpt to erase the drive and create one", drive.Path),
+				}
+			}
+		case partitionTableDos:
+			if current != partitionTableDos && (drive.Append || current != "") {
+				return &PartitionTableCompatibilityError{
+					Err: fmt.Errorf("drive '%s' is not compatible: partition table must be DOS, or the drive must be blank when not appending", drive.Path),
+				}
 			}
 		}
 	}
 	return nil
 }
 
-// Create Partitions from a list of Drives using sfdisk
+// Create Partitions from a list of Drives using sfdisk, the sizes
+// being resolved by the FitReport of the drives
+// The existing partitions reused by the drives are found first, nothing
+// being written if one of them can't be or is deleted, then the partitions
+// the drives delete are deleted and the ones they shrink are shrunk, as
+// found by the FitReport
 //
-// Returns a mapping of the Partition and its corresponding SfdiskJsonPartition
-// to map the Partition object to the partition created on the system
+// Returns the Layout mapping each Partition to its corresponding SfdiskJsonPartition node
+// to map the Partition object to the partition created on the system, or to the node
+// of the existing partition it reuses
 // Can return one type of error: SetupPartitionsError
-func createPartitions(drives []Drive) ([]map[Partition]SfdiskJsonPartition, error) {
-	partitioningFiles, err := createPartitioningFiles(drives)
+func createPartitions(r runner.Runner, drives []Drive, fitReport *FitReport) (Layout, error) {
+	existingNodes, err := resolveExistingPartitions(r, drives)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, drive := range drives {
+		for j, node := range existingNodes[i] {
+			if node != "" && slices.Contains(fitReport.Drives[i].Deleted, node) {
+				return nil, &SetupPartitionsError{
+					Err: fmt.Errorf("error finding existing partition '%s': '%s' is deleted", drive.Partitions[j].Existing, node),
+				}
+			}
+		}
+	}
+
+	for i, drive := range drives {
+		if err := deletePartitions(r, drive.Path, fitReport.Drives[i].Deleted); err != nil {
+			return nil, err
+		}
+		for _, estimate := range fitReport.Drives[i].Shrinks {
+			if err := shrinkPartition(r, drive.Path, fitReport.Drives[i].SectorSize, estimate); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	scripts, err := createSfdiskScripts(drives, fitReport)
 	if err != nil {
 		return nil, err
 	}
 
-	var mappings []map[Partition]SfdiskJsonPartition
+	var layout Layout
 
-	for drive, fileName := range partitioningFiles {
-		sfdiskCommand := ""
+	for i := range drives {
+		drive := &drives[i]
+		k := slices.IndexFunc(scripts, func(s sfdiskScript) bool { return s.drive == drive })
+		if k < 0 {
+			// Only existing partitions are reused on the drive
+			for j, partition := range drive.Partitions {
+				layout = append(layout, MappedPartition{
+					Partition: partition,
+					Node:      existingNodes[i][j],
+					Drive:     drive.Path,
+				})
+			}
+			continue
+		}
+
+		var sfdiskArgs []string
 		var initialState *SfdiskJsonDrive
 
 		if drive.Append {
-			initialState, err = getDriveStateWithSfdisk(drive.Path)
+			initialState, err = getDriveStateWithSfdisk(r, drive.Path)
 			if err != nil {
 				return nil, &SetupPartitionsError{
 					Err: fmt.Errorf("error getting initial state of drive '%s': error=%s", drive.Path, err.Error()),
 				}
 			}
-			sfdiskCommand = fmt.Sprintf("sfdisk -a %s < %s", drive.Path, fileName)
+			sfdiskArgs = []string{"-a", drive.Path}
 		} else {
-			sfdiskCommand = fmt.Sprintf("sfdisk %s < %s", drive.Path, fileName)
+			sfdiskArgs = []string{drive.Path}
 		}
 
-		cmd := exec.Command("/bin/bash", "-c", sfdiskCommand)
-		stderr, err := cmd.StderrPipe()
-		if err != nil {
-			return nil, &SetupPartitionsError{
-				Err: fmt.Errorf("error piping stderr: error=%s", err.Error()),
+		if drive.EraseAndCreateGpt {
+			if _, err := r.Run(runner.Command("wipefs", "--all", drive.Path)); err != nil {
+				return nil, &SetupPartitionsError{
+					Err: fmt.Errorf("error erasing the signatures of drive '%s': error=%s", drive.Path, err.Error()),
+				}
 			}
 		}
 
-		if err := cmd.Run(); err != nil {
-			stderrOutput, _ := io.ReadAll(stderr)
+		cmd := runner.Command("sfdisk", sfdiskArgs...)
+		cmd.Stdin = scripts[k].script
+		if _, err := r.Run(cmd); err != nil {
 			return nil, &SetupPartitionsError{
-				Err: fmt.Errorf("error creating partitions on drive '%s' with file '%s' using sfdisk: error=%s", drive.Path, fileName, string(stderrOutput)),
+				Err: fmt.Errorf("error creating partitions on drive '%s' using sfdisk: error=%s", drive.Path, err.Error()),
 			}
 		}
 
-		stateAfterCreatingPartitions, err := getDriveStateWithSfdisk(drive.Path)
+		stateAfterCreatingPartitions, err := getDriveStateWithSfdisk(r, drive.Path)
 		var newPartitions []SfdiskJsonPartition
 		if err != nil {
 			return nil, &SetupPartitionsError{
@@ -134,58 +275,110 @@ func createPartitions(drives []Drive) ([]map[Partition]SfdiskJsonPartition, erro
 			}
 		}
 		if initialState != nil {
-			newPartitions = stateAfterCreatingPartitions.PartitionTable.Partitions[len(initialState.PartitionTable.Partitions):]
+			// The new partitions can take the numbers of deleted ones, they aren't always listed last
+			newPartitions = slices.DeleteFunc(stateAfterCreatingPartitions.PartitionTable.Partitions, func(p SfdiskJsonPartition) bool {
+				return slices.ContainsFunc(initialState.PartitionTable.Partitions, func(initial SfdiskJsonPartition) bool { return initial.Node == p.Node })
+			})
 		} else {
 			newPartitions = stateAfterCreatingPartitions.PartitionTable.Partitions
 		}
 
-		partitionsMap := make(map[Partition]SfdiskJsonPartition)
-		for i := 0; i < len(newPartitions) || i < len(drive.Partitions); i++ {
-			partitionsMap[drive.Partitions[i]] = newPartitions[i]
+		if requested := len(drive.newPartitions()); len(newPartitions) != requested {
+			return nil, &SetupPartitionsError{
+				Err: fmt.Errorf("error mapping partitions of drive '%s': %d partitions were requested but %d were created", drive.Path, requested, len(newPartitions)),
+			}
+		}
+		for j, partition := range drive.Partitions {
+			node := existingNodes[i][j]
+			if partition.Existing == nil {
+				node = newPartitions[0].Node
+				newPartitions = newPartitions[1:]
+			}
+			layout = append(layout, MappedPartition{
+				Partition: partition,
+				Node:      node,
+				Drive:     drive.Path,
+			})
 		}
-
-		mappings = append(mappings, partitionsMap)
 	}
 
-	return mappings, nil
+	return layout, nil
 }
 
-// Creates one file per drive containing its partitions in sfdisk named-fields syntax
-// from a list of Drives
+// sfdiskScript represents the sfdisk script creating the new partitions of a drive
+type sfdiskScript struct {
+	drive  *Drive
+	script string
+}
+
+// Creates one script per drive containing its partitions in sfdisk named-fields syntax
+// from a list of Drives and their FitReport, the existing partitions being left out
+// The script is fed to sfdisk through STDIN
+// When the partition table gets replaced, the script starts with its type, and on a
+// DOS partition table the partition holding /boot (or /) is marked as bootable, unless
+// it is an existing partition
 //
-// Returns a map of the drives and their files name
+// Returns the scripts in the same order as the drives, without the drives that
+// only reuse existing partitions
 // Can return one type of error: SetupPartitionsError
-func createPartitioningFiles(drives []Drive) (map[*Drive]string, error) {
-	drivePartitionsFiles := make(map[*Drive]string)
-	for _, drive := range drives {
-		fileName := strings.ReplaceAll(drive.Path, "/", "")
-		drivePartitionsFiles[&drive] = fileName
-
-		file, err := os.Create(fileName)
-		if err != nil {
+func createSfdiskScripts(drives []Drive, fitReport *FitReport) ([]sfdiskScript, error) {
+	var scripts []sfdiskScript
+	for i := range drives {
+		drive := &drives[i]
+		fits := fitReport.Drives[i].Partitions
+		requested := len(drive.newPartitions())
+		if requested == 0 {
+			continue
+		}
+		if len(fits) != requested {
 			return nil, &SetupPartitionsError{
-				Err: fmt.Errorf("could not create file '%s' for '%s' drive partitioning: error=%s", fileName, drive.Path, err.Error()),
+				Err: fmt.Errorf("error resolving the partition sizes of drive '%s': only %d of its %d partitions fit", drive.Path, len(fits), requested),
 			}
 		}
-		defer file.Close()
 
-		for _, partition := range drive.Partitions {
-			partitionEntry := fmt.Sprintf("%s\n", partition.toSfdiskFormat())
-			_, err := file.WriteString(partitionEntry)
-			if err != nil {
-				return nil, &SetupPartitionsError{
-					Err: fmt.Errorf("could not edit file '%s' for partitioning: error=%s", fileName, err.Error()),
-				}
+		var script strings.Builder
+		if !drive.Append {
+			script.WriteString(fmt.Sprintf("label: %s\n", drive.partitionTable()))
+		}
+		bootable := -1
+		if drive.partitionTable() == partitionTableDos {
+			bootable = bootPartitionIndex(drive.Partitions)
+		}
+		for j, partition := range drive.Partitions {
+			if partition.Existing != nil {
+				continue
 			}
+			script.WriteString(fmt.Sprintf("%s\n", partition.toSfdiskFormat(fits[0], fitReport.Drives[i].SectorSize, drive.partitionTable(), j == bootable)))
+			fits = fits[1:]
 		}
+
+		scripts = append(scripts, sfdiskScript{
+			drive:  drive,
+			script: script.String(),
+		})
 	}
-	return drivePartitionsFiles, nil
+	return scripts, nil
+}
+
+// Returns the index of the partition mounted at /boot, or at / when none is,
+// or -1 if there is none
+func bootPartitionIndex(partitions []Partition) int {
+	index := -1
+	for i, p := range partitions {
+		if p.holds(bootMountPoint) {
+			return i
+		}
+		if isRoot(p) {
+			index = i
+		}
+	}
+	return index
 }
 
 // Formats a partition
 //
 // Can return one type of error: SetupPartitionsError
-func formatPartition(partition Partition, path string) error {
+func formatPartition(r runner.Runner, partition Partition, path string) error {
 	cmd, err := partition.formatCommand(path)
 	if err != nil {
 		return &SetupPartitionsError{
@@ -193,7 +386,7 @@ func formatPartition(partition Partition, path string) error {
 		}
 	}
 
-	if err := cmd.Run(); err != nil {
+	if _, err := r.Run(cmd); err != nil {
 		return &SetupPartitionsError{
 			Err: fmt.Errorf("error formatting partition '%s': error=%s", path, err.Error()),
 		}
@@ -205,19 +398,39 @@ func formatPartition(partition Partition, path string) error {
 // Mounts a partition
 //
 // Can return one type of error: SetupPartitionsError
-func mountPartition(partition Partition, path string) error {
-	cmd, err := partition.mountCommand(path)
-	if err != nil {
+func mountPartition(r runner.Runner, m Mount) error {
+	if _, err := r.Run(m.command()); err != nil {
 		return &SetupPartitionsError{
-			Err: fmt.Errorf("error mounting partition '%s': error=%s", path, err.Error()),
+			Err: fmt.Errorf("error mounting partition '%s': error=%s", m.Node, err.Error()),
 		}
 	}
 
-	if err := cmd.Run(); err != nil {
-		return &SetupPartitionsError{
-			Err: fmt.Errorf("error mounting partition '%s': error=%s", path, err.Error()),
+	return nil
+}
+
+// Checks if the partition is already mounted on the target of the mount, or already used as swap
+//
+// Can return one type of error: SetupPartitionsError
+func isMounted(r runner.Runner, m Mount) (bool, error) {
+	path := m.Node
+	if m.Partition.IsSwap() {
+		result, err := r.Query(runner.Command("swapon", "--show=NAME", "--noheadings"))
+		if err != nil {
+			return false, &SetupPartitionsError{
+				Err: fmt.Errorf("error listing swap partitions: error=%s", err.Error()),
+			}
 		}
+		return slices.Contains(strings.Fields(result.Stdout), path), nil
 	}
 
-	return nil
+	result, err := r.Query(runner.Command("findmnt", "--noheadings", "--source", path, "--mountpoint", m.Target))
+	if result.ExitCode == 1 { // not mounted
+		return false, nil
+	}
+	if err != nil {
+		return false, &SetupPartitionsError{
+			Err: fmt.Errorf("error checking if partition '%s' is mounted: error=%s", path, err.Error()),
+		}
+	}
+	return true, nil
 }
@@ -0,0 +1,254 @@
+package partition
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+// Returns the output of 'sfdisk --json <drive>' listing the given nodes
+func sfdiskJson(t *testing.T, drive string, nodes ...string) string {
+	t.Helper()
+
+	state := SfdiskJsonDrive{
+		PartitionTable: SfdiskJsonPartitionTable{Device: drive},
+	}
+	for _, node := range nodes {
+		state.PartitionTable.Partitions = append(state.PartitionTable.Partitions, SfdiskJsonPartition{Node: node})
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCreatePartitionsMapping(t *testing.T) {
+	efi := Partition{
+		Size:          PartitionSize{Amount: 1, Unit: "GiB"},
+		FileSystem:    "fat32",
+		PartitionType: "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+		MountPoint:    "/boot",
+	}
+	root := Partition{
+		Size:          PartitionSize{TakeRemaining: true},
+		FileSystem:    "ext4",
+		PartitionType: "4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709",
+		MountPoint:    "/",
+	}
+	existingEfi := efi
+	existingEfi.Size = PartitionSize{}
+	existingEfi.Existing = &ExistingPartition{PartitionReference: PartitionReference{Node: "/dev/sda1"}, Format: true}
+
+	tests := []struct {
+		name  string
+		drive Drive
+		// deleted are the nodes of the partitions the drive deletes
+		deleted []string
+		// states are the outputs of 'sfdisk --json', in order
+		states     []string
+		wantNodes  []string
+		wantCalls  []string
+		wantScript string
+		wantErr    bool
+	}{
+		{
+			name:      "new partition table",
+			drive:     Drive{Path: "/dev/sda", Partitions: []Partition{efi, root}},
+			states:    []string{sfdiskJson(t, "/dev/sda", "/dev/sda1", "/dev/sda2")},
+			wantNodes: []string{"/dev/sda1", "/dev/sda2"},
+			wantCalls: []string{"run: sfdisk /dev/sda", "query: sfdisk --json /dev/sda"},
+			wantScript: "label: gpt\n" +
+				"start=2048, type=C12A7328-F81F-11D2-BA4B-00A0C93EC93B, size=1GiB\n" +
+				"start=4096, type=4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709, size=+\n",
+		},
+		{
+			name:      "new DOS partition table",
+			drive:     Drive{Path: "/dev/sda", PartitionTable: "dos", Partitions: []Partition{efi, root}},
+			states:    []string{sfdiskJson(t, "/dev/sda", "/dev/sda1", "/dev/sda2")},
+			wantNodes: []string{"/dev/sda1", "/dev/sda2"},
+			wantCalls: []string{"run: sfdisk /dev/sda", "query: sfdisk --json /dev/sda"},
+			wantScript: "label: dos\n" +
+				"start=2048, type=ef, size=1GiB, bootable\n" +
+				"start=4096, type=83, size=+\n",
+		},
+		{
+			name:  "appended after the existing partitions",
+			drive: Drive{Path: "/dev/nvme0n1", Append: true, Partitions: []Partition{efi, root}},
+			states: []string{
+				sfdiskJson(t, "/dev/nvme0n1", "/dev/nvme0n1p1"),
+				sfdiskJson(t, "/dev/nvme0n1", "/dev/nvme0n1p1", "/dev/nvme0n1p2", "/dev/nvme0n1p3"),
+			},
+			wantNodes: []string{"/dev/nvme0n1p2", "/dev/nvme0n1p3"},
+			wantCalls: []string{"query: sfdisk --json /dev/nvme0n1", "run: sfdisk -a /dev/nvme0n1", "query: sfdisk --json /dev/nvme0n1"},
+			wantScript: "start=2048, type=C12A7328-F81F-11D2-BA4B-00A0C93EC93B, size=1GiB\n" +
+				"start=4096, type=4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709, size=+\n",
+		},
+		{
+			name:  "reusing an existing partition",
+			drive: Drive{Path: "/dev/sda", Append: true, Partitions: []Partition{existingEfi, root}},
+			states: []string{
+				sfdiskJson(t, "/dev/sda", "/dev/sda1"),
+				sfdiskJson(t, "/dev/sda", "/dev/sda1"),
+				sfdiskJson(t, "/dev/sda", "/dev/sda1", "/dev/sda2"),
+			},
+			wantNodes:  []string{"/dev/sda1", "/dev/sda2"},
+			wantCalls:  []string{"query: sfdisk --json /dev/sda", "query: sfdisk --json /dev/sda", "run: sfdisk -a /dev/sda", "query: sfdisk --json /dev/sda"},
+			wantScript: "start=2048, type=4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709, size=+\n",
+		},
+		{
+			name:      "only existing partitions",
+			drive:     Drive{Path: "/dev/sda", Append: true, Partitions: []Partition{existingEfi}},
+			states:    []string{sfdiskJson(t, "/dev/sda", "/dev/sda1")},
+			wantNodes: []string{"/dev/sda1"},
+			wantCalls: []string{"query: sfdisk --json /dev/sda"},
+		},
+		{
+			name:    "reusing the number of a deleted partition",
+			drive:   Drive{Path: "/dev/sda", Append: true, Partitions: []Partition{existingEfi, root}, Delete: []PartitionReference{{Number: 2}}},
+			deleted: []string{"/dev/sda2"},
+			states: []string{
+				sfdiskJson(t, "/dev/sda", "/dev/sda1", "/dev/sda2", "/dev/sda3"),
+				sfdiskJson(t, "/dev/sda", "/dev/sda1", "/dev/sda3"),
+				sfdiskJson(t, "/dev/sda", "/dev/sda1", "/dev/sda2", "/dev/sda3"),
+			},
+			wantNodes: []string{"/dev/sda1", "/dev/sda2"},
+			wantCalls: []string{
+				"query: sfdisk --json /dev/sda",
+				"run: sfdisk --delete /dev/sda 2",
+				"query: sfdisk --json /dev/sda",
+				"run: sfdisk -a /dev/sda",
+				"query: sfdisk --json /dev/sda",
+			},
+			wantScript: "start=2048, type=4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709, size=+\n",
+		},
+		{
+			name:      "reusing a deleted partition",
+			drive:     Drive{Path: "/dev/sda", Append: true, Partitions: []Partition{existingEfi, root}, Delete: []PartitionReference{{Node: "/dev/sda1"}}},
+			deleted:   []string{"/dev/sda1"},
+			states:    []string{sfdiskJson(t, "/dev/sda", "/dev/sda1")},
+			wantCalls: []string{"query: sfdisk --json /dev/sda"},
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := runner.NewFake()
+			for _, state := range test.states {
+				f.OnOutput("sfdisk --json "+test.drive.Path, state)
+			}
+
+			fit := DriveFit{Path: test.drive.Path, SectorSize: 512, Deleted: test.deleted, Fits: true}
+			for j := range test.drive.newPartitions() {
+				// Each partition of 1 MiB starts 1 MiB after the previous one
+				fit.Partitions = append(fit.Partitions, PartitionFit{Start: int64(j+1) << 20, Size: 1 << 20, Sectors: 2048})
+			}
+
+			layout, err := createPartitions(f, []Drive{test.drive}, &FitReport{Drives: []DriveFit{fit}})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("createPartitions() error = %v, want error %t", err, test.wantErr)
+			}
+			if !slices.Equal(f.Calls, test.wantCalls) {
+				t.Errorf("calls = %q, want %q", f.Calls, test.wantCalls)
+			}
+			if test.wantErr {
+				return
+			}
+			// The script is given to the sfdisk call creating the partitions
+			i := slices.IndexFunc(f.Calls, func(call string) bool {
+				return strings.HasPrefix(call, "run: sfdisk ") && !strings.HasPrefix(call, "run: sfdisk --delete ")
+			})
+			script := ""
+			if i >= 0 {
+				script = f.Inputs[i]
+			}
+			if script != test.wantScript {
+				t.Errorf("sfdisk script = %q, want %q", script, test.wantScript)
+			}
+
+			var nodes []string
+			for _, mapped := range layout {
+				nodes = append(nodes, mapped.Node)
+			}
+			if !slices.Equal(nodes, test.wantNodes) {
+				t.Errorf("nodes = %q, want %q", nodes, test.wantNodes)
+			}
+		})
+	}
+}
+
+func TestFormatPartition(t *testing.T) {
+	tests := []struct {
+		name      string
+		partition Partition
+		// failing makes the formatting command fail
+		failing   bool
+		wantCalls []string
+		wantErr   bool
+	}{
+		{
+			name:      "ext4 with its label and options",
+			partition: Partition{FileSystem: fileSystemExt4, PartitionType: gptPartitionTypeRoot, Label: "root", MkfsOptions: []string{"-i=16384"}},
+			wantCalls: []string{"run: mkfs.ext4 -F -L root -i 16384 /dev/sda2"},
+		},
+		{
+			name:      "btrfs",
+			partition: Partition{FileSystem: fileSystemBtrfs, PartitionType: gptPartitionTypeRoot},
+			wantCalls: []string{"run: mkfs.btrfs -f /dev/sda2"},
+		},
+		{
+			name:      "xfs with its UUID",
+			partition: Partition{FileSystem: fileSystemXfs, PartitionType: gptPartitionTypeRoot, Uuid: "0a3407de-014b-458b-b5c1-848e92a327a3"},
+			wantCalls: []string{"run: mkfs.xfs -f -m uuid=0a3407de-014b-458b-b5c1-848e92a327a3 /dev/sda2"},
+		},
+		{
+			name:      "f2fs",
+			partition: Partition{FileSystem: fileSystemF2fs, PartitionType: gptPartitionTypeRoot},
+			wantCalls: []string{"run: mkfs.f2fs -f /dev/sda2"},
+		},
+		{
+			name:      "EFI system partition",
+			partition: Partition{PartitionType: gptPartitionTypeEfi},
+			wantCalls: []string{"run: mkfs.fat -F 32 /dev/sda2"},
+		},
+		{
+			name:      "swap",
+			partition: Partition{PartitionType: gptPartitionTypeSwap},
+			wantCalls: []string{"run: mkswap /dev/sda2"},
+		},
+		{
+			name:      "Linux LVM partition",
+			partition: Partition{PartitionType: gptPartitionTypeLvm},
+			wantErr:   true,
+		},
+		{
+			name:      "failing",
+			partition: Partition{FileSystem: fileSystemExt4, PartitionType: gptPartitionTypeRoot},
+			failing:   true,
+			wantCalls: []string{"run: mkfs.ext4 -F /dev/sda2"},
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := runner.NewFake()
+			if test.failing {
+				f.On("mkfs.ext4 -F /dev/sda2", runner.Result{ExitCode: 1, Stderr: "failed"})
+			}
+
+			err := formatPartition(f, test.partition, "/dev/sda2")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("formatPartition() error = %v, want error %t", err, test.wantErr)
+			}
+			if !slices.Equal(f.Calls, test.wantCalls) {
+				t.Errorf("calls = %q, want %q", f.Calls, test.wantCalls)
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package partition
 import (
 	"encoding/json"
 	"fmt"
-	"io"
-	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
 )
 
 // SfdiskJsonDrive represents the JSON output from 'sfdisk --json <device>'
@@ -14,13 +16,22 @@ type SfdiskJsonDrive struct {
 
 // SfdiskJsonPartitionTable represents the 'partitiontable' field of SfdiskJsonDrive
 type SfdiskJsonPartitionTable struct {
-	Device     string                `json:"device"`
+	// Label is the partition table type, "gpt" or "dos"
+	Label  string `json:"label"`
+	Device string `json:"device"`
+	// FirstLba and LastLba are the first and last sectors usable by partitions
+	FirstLba   int64                 `json:"firstlba"`
+	LastLba    int64                 `json:"lastlba"`
+	SectorSize int64                 `json:"sectorsize"`
 	Partitions []SfdiskJsonPartition `json:"partitions"`
 }
 
 // SfdiskJsonPartition represents one element of the 'partitions' field/array of SfdiskJsonPartitionTable
 type SfdiskJsonPartition struct {
 	Node string `json:"node"`
+	// Start and Size are in sectors
+	Start int64 `json:"start"`
+	Size  int64 `json:"size"`
 }
 
 // Gets a drive's state using 'sfdisk --json <device>'
@@ -28,42 +39,32 @@ type SfdiskJsonPartition struct {
 //
 // Decodes the JSON state into a SfdiskJsonDrive object and returns it
 // Can return one type of error: SetupPartitionsError
-func getDriveStateWithSfdisk(drive string) (*SfdiskJsonDrive, error) {
-	cmd := exec.Command("sfdisk", "--json", drive)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, &SetupPartitionsError{
-			Err: fmt.Errorf("error piping stdout: error=%s", err.Error()),
-		}
-	}
-	stderr, err := cmd.StderrPipe()
+func getDriveStateWithSfdisk(r runner.Runner, drive string) (*SfdiskJsonDrive, error) {
+	result, err := r.Query(runner.Command("sfdisk", "--json", drive))
 	if err != nil {
 		return nil, &SetupPartitionsError{
-			Err: fmt.Errorf("error piping stderr: error=%s", err.Error()),
-		}
-	}
-	if err := cmd.Start(); err != nil {
-		stderrOutput, _ := io.ReadAll(stderr)
-		return nil, &SetupPartitionsError{
-			Err: fmt.Errorf("error getting drive state as JSON using sfdisk: error=%s", string(stderrOutput)),
-		}
-	}
-	var stdoutOutput []byte
-	if stdoutOutput, err = io.ReadAll(stdout); err != nil {
-		return nil, &SetupPartitionsError{
-			Err: fmt.Errorf("error reading stdout: error=%s", err.Error()),
-		}
-	}
-	if err := cmd.Wait(); err != nil {
-		return nil, &SetupPartitionsError{
-			Err: fmt.Errorf("error reading stdout: error=%s", err.Error()),
+			Err: fmt.Errorf("error getting drive state as JSON using sfdisk: error=%s", err.Error()),
 		}
 	}
 	var sjd SfdiskJsonDrive
-	if err = json.Unmarshal(stdoutOutput, &sjd); err != nil {
+	if err = json.Unmarshal([]byte(result.Stdout), &sjd); err != nil {
 		return nil, &SetupPartitionsError{
 			Err: fmt.Errorf("error decoding JSON drive state coming from stdout of sfdisk: error=%s", err.Error()),
 		}
 	}
 	return &sjd, nil
 }
+
+// Returns the number of the partition at node, e.g. 3 for /dev/sda3 or /dev/nvme0n1p3
+//
+// Can return one type of error: SetupPartitionsError
+func partitionNumber(node string) (int, error) {
+	digits := node[len(strings.TrimRight(node, "0123456789")):]
+	number, err := strconv.Atoi(digits)
+	if err != nil || number == 0 {
+		return 0, &SetupPartitionsError{
+			Err: fmt.Errorf("error getting the number of partition '%s': its node doesn't end by it", node),
+		}
+	}
+	return number, nil
+}
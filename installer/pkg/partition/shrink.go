@@ -0,0 +1,286 @@
+package partition
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+// File system type given by blkid to a Windows partition
+const fileSystemNtfs string = "ntfs"
+
+// File systems that can be shrunk, with their partition
+var shrinkableFileSystems []string = []string{
+	fileSystemNtfs,
+	fileSystemExt4,
+	fileSystemBtrfs,
+}
+
+// Outputs giving the smallest size of a file system, see minimumFileSystemSize
+var (
+	ntfsresizeMinimumRegexp *regexp.Regexp = regexp.MustCompile(`You might resize at (\d+) bytes`)
+	resize2fsMinimumRegexp  *regexp.Regexp = regexp.MustCompile(`Estimated minimum size of the filesystem: (\d+)`)
+	dumpe2fsBlockSizeRegexp *regexp.Regexp = regexp.MustCompile(`(?m)^Block size:\s+(\d+)`)
+	btrfsMinDevSizeRegexp   *regexp.Regexp = regexp.MustCompile(`(?m)^(\d+) bytes`)
+)
+
+// PartitionShrink represents an existing partition of the drive shrunk, with its file system,
+// to make room for the new partitions, e.g. a Windows partition on a dual-boot laptop
+// Possible attributes values:
+// - Number, Node, PartUuid, Label: see PartitionReference
+// - Size: the new size of the partition, a fixed size like "200GiB" rounded down to a multiple
+// of 1 MiB; its file system must be ntfs, ext4 or btrfs, and its used space must fit in it
+type PartitionShrink struct {
+	PartitionReference
+	Size PartitionSize `json:"size"`
+}
+
+// ShrinkEstimate represents what shrinking a partition would do, every size being in bytes
+type ShrinkEstimate struct {
+	Node       string `json:"node"`
+	FileSystem string `json:"fileSystem"`
+	Size       int64  `json:"size"`
+	// MinimumSize is the smallest size the file system can be shrunk to
+	MinimumSize int64 `json:"minimumSize"`
+	NewSize     int64 `json:"newSize"`
+	Freed       int64 `json:"freed"`
+	// Problem explains why the partition can't be shrunk
+	Problem string `json:"problem,omitempty"`
+}
+
+// Checks the attributes of a PartitionShrink struct
+// Adds every problem found to the report, path being the JSON path of the shrink
+func (s *PartitionShrink) Check(path string, report *validation.Report) {
+	s.PartitionReference.Check(path, report)
+
+	sizePath := validation.Field(path, "size")
+	s.Size.Check(sizePath, report)
+	if _, ok := s.Size.Bytes(); !ok || s.Size.Min != "" || s.Size.Max != "" {
+		report.Add(sizePath, validation.CodeInvalid, "Size must be a fixed size, e.g. \"200GiB\", without percentage, Min, Max or TakeRemaining")
+	}
+}
+
+// Computes what shrinking the partition would do, without writing anything: its
+// file system and the smallest size it can be shrunk to are read from the partition,
+// state being the output of 'sfdisk --json <drive>'
+//
+// Returns the estimate and the index of the partition inside state, the estimate
+// having a Problem when the partition can't be shrunk to its new Size
+// Can return one type of error: SetupPartitionsError
+func (s *PartitionShrink) estimate(r runner.Runner, drive string, state *SfdiskJsonDrive, sectorSize int64) (ShrinkEstimate, int, error) {
+	found, err := s.find(r, drive, state)
+	if err != nil {
+		return ShrinkEstimate{}, -1, err
+	}
+	index := slices.IndexFunc(state.PartitionTable.Partitions, func(p SfdiskJsonPartition) bool { return p.Node == found.Node })
+
+	requested, _ := s.Size.Bytes()
+	estimate := ShrinkEstimate{
+		Node:    found.Node,
+		Size:    found.Size * sectorSize,
+		NewSize: requested / partitionAlignment * partitionAlignment,
+	}
+
+	result, err := r.Query(runner.Command("blkid", "--match-tag", "TYPE", "--output", "value", found.Node))
+	if err != nil {
+		return estimate, index, &SetupPartitionsError{
+			Err: fmt.Errorf("error getting the file system of partition '%s': error=%s", found.Node, err.Error()),
+		}
+	}
+	estimate.FileSystem = strings.TrimSpace(result.Stdout)
+	if !slices.Contains(shrinkableFileSystems, estimate.FileSystem) {
+		estimate.Problem = fmt.Sprintf("partition '%s' holds '%s', only %s can be shrunk", found.Node, estimate.FileSystem, strings.Join(shrinkableFileSystems, ", "))
+		return estimate, index, nil
+	}
+
+	estimate.MinimumSize, err = minimumFileSystemSize(r, estimate.FileSystem, found.Node)
+	if err != nil {
+		return estimate, index, err
+	}
+
+	switch {
+	case estimate.NewSize >= estimate.Size:
+		estimate.Problem = fmt.Sprintf("partition '%s' can't be shrunk to %d bytes, it is only %d bytes", found.Node, estimate.NewSize, estimate.Size)
+	case estimate.NewSize < estimate.MinimumSize:
+		estimate.Problem = fmt.Sprintf("partition '%s' can't be shrunk to %d bytes, its file system needs at least %d bytes", found.Node, estimate.NewSize, estimate.MinimumSize)
+	default:
+		estimate.Freed = estimate.Size - estimate.NewSize
+	}
+	return estimate, index, nil
+}
+
+// Returns the smallest size in bytes the file system of the partition can be shrunk
+// to, read without changing it; btrfs only gives it while mounted, it is mounted
+// read-only for the time of the query
+//
+// It executes, depending on the file system:
+//
+//	ntfsresize --info --force --no-progress-bar <node>
+//	dumpe2fs -h <node> and resize2fs -P <node>
+//	mount --mkdir -o ro <node> /run/october-installer/btrfs, btrfs inspect-internal min-dev-size /run/october-installer/btrfs and umount /run/october-installer/btrfs
+//
+// Can return one type of error: SetupPartitionsError
+func minimumFileSystemSize(r runner.Runner, fileSystem string, node string) (int64, error) {
+	query := func(re *regexp.Regexp, name string, args ...string) (int64, error) {
+		result, err := r.Query(runner.Command(name, args...))
+		if err != nil {
+			return 0, &SetupPartitionsError{
+				Err: fmt.Errorf("error getting the used space of partition '%s': error=%s", node, err.Error()),
+			}
+		}
+		match := re.FindStringSubmatch(result.Stdout)
+		if match == nil {
+			return 0, &SetupPartitionsError{
+				Err: fmt.Errorf("error getting the used space of partition '%s': unexpected %s output", node, name),
+			}
+		}
+		value, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return 0, &SetupPartitionsError{
+				Err: fmt.Errorf("error getting the used space of partition '%s': error=%s", node, err.Error()),
+			}
+		}
+		return value, nil
+	}
+
+	switch fileSystem {
+	case fileSystemNtfs:
+		return query(ntfsresizeMinimumRegexp, "ntfsresize", "--info", "--force", "--no-progress-bar", node)
+	case fileSystemExt4:
+		blockSize, err := query(dumpe2fsBlockSizeRegexp, "dumpe2fs", "-h", node)
+		if err != nil {
+			return 0, err
+		}
+		blocks, err := query(resize2fsMinimumRegexp, "resize2fs", "-P", node)
+		return blocks * blockSize, err
+	case fileSystemBtrfs:
+		if _, err := r.Query(runner.Command("mount", "--mkdir", "-o", "ro", node, btrfsTopLevelDirectory)); err != nil {
+			return 0, &SetupPartitionsError{
+				Err: fmt.Errorf("error mounting partition '%s' read-only: error=%s", node, err.Error()),
+			}
+		}
+		defer r.Query(runner.Command("umount", btrfsTopLevelDirectory))
+
+		// Takes the allocated chunks and the metadata and system profiles into account
+		return query(btrfsMinDevSizeRegexp, "btrfs", "inspect-internal", "min-dev-size", btrfsTopLevelDirectory)
+	}
+	return 0, &SetupPartitionsError{
+		Err: fmt.Errorf("error getting the used space of partition '%s': '%s' can't be shrunk", node, fileSystem),
+	}
+}
+
+// Computes the estimate of every partition shrunk on the drive, and resizes them inside
+// state so the space they free can be used by the new partitions
+//
+// Returns the estimates, and the problem of the first partition that can't be shrunk
+// Can return one type of error: SetupPartitionsError
+func estimateShrinks(r runner.Runner, drive Drive, state *SfdiskJsonDrive, sectorSize int64) ([]ShrinkEstimate, string, error) {
+	var estimates []ShrinkEstimate
+	problem := ""
+	for _, s := range drive.Shrink {
+		estimate, index, err := s.estimate(r, drive.Path, state, sectorSize)
+		if err != nil {
+			return nil, "", err
+		}
+		estimates = append(estimates, estimate)
+		if estimate.Problem != "" {
+			if problem == "" {
+				problem = estimate.Problem
+			}
+			continue
+		}
+		state.PartitionTable.Partitions[index].Size = estimate.NewSize / sectorSize
+	}
+	return estimates, problem, nil
+}
+
+// Shrinks the file system of a partition, then the partition, as estimated by Fit
+//
+// It executes, depending on the file system:
+//
+//	ntfsresize --force --no-progress-bar --size <bytes> <node>
+//	e2fsck -f -y <node> and resize2fs <node> <KiB>K
+//	mount --mkdir <node> /run/october-installer/btrfs, btrfs filesystem resize <bytes> /run/october-installer/btrfs and umount /run/october-installer/btrfs
+//
+// followed by:
+//
+//	sfdisk -N <number> <drive> (with 'size=<sectors>' as STDIN)
+//
+// Can return one type of error: SetupPartitionsError
+func shrinkPartition(r runner.Runner, drive string, sectorSize int64, estimate ShrinkEstimate) error {
+	node := estimate.Node
+	var cmds []runner.Cmd
+	switch estimate.FileSystem {
+	case fileSystemNtfs:
+		cmd := runner.Command("ntfsresize", "--force", "--no-progress-bar", "--size", strconv.FormatInt(estimate.NewSize, 10), node)
+		// ntfsresize asks for a confirmation
+		cmd.Stdin = "y\n"
+		cmds = append(cmds, cmd)
+	case fileSystemExt4:
+		// resize2fs needs a freshly checked file system
+		cmds = append(cmds,
+			runner.Command("e2fsck", "-f", "-y", node),
+			runner.Command("resize2fs", node, fmt.Sprintf("%dK", estimate.NewSize/1024)),
+		)
+	case fileSystemBtrfs:
+		if err := resizeBtrfs(r, node, estimate.NewSize); err != nil {
+			return err
+		}
+	default:
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("error shrinking partition '%s': '%s' can't be shrunk", node, estimate.FileSystem),
+		}
+	}
+
+	for _, cmd := range cmds {
+		if _, err := r.Run(cmd); err != nil {
+			return &SetupPartitionsError{
+				Err: fmt.Errorf("error shrinking the file system of partition '%s': error=%s", node, err.Error()),
+			}
+		}
+	}
+
+	number, err := partitionNumber(node)
+	if err != nil {
+		return err
+	}
+	cmd := runner.Command("sfdisk", "-N", strconv.Itoa(number), drive)
+	cmd.Stdin = fmt.Sprintf("size=%d\n", estimate.NewSize/sectorSize)
+	if _, err := r.Run(cmd); err != nil {
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("error shrinking partition '%s' using sfdisk: error=%s", node, err.Error()),
+		}
+	}
+	return nil
+}
+
+// Resizes the btrfs file system of the partition, which is only possible while
+// it is mounted; it gets unmounted even when it can't be resized
+//
+// Can return one type of error: SetupPartitionsError
+func resizeBtrfs(r runner.Runner, node string, size int64) (err error) {
+	if _, err := r.Run(runner.Command("mount", "--mkdir", node, btrfsTopLevelDirectory)); err != nil {
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("error shrinking the file system of partition '%s': error=%s", node, err.Error()),
+		}
+	}
+	defer func() {
+		if _, umountErr := r.Run(runner.Command("umount", btrfsTopLevelDirectory)); umountErr != nil && err == nil {
+			err = &SetupPartitionsError{
+				Err: fmt.Errorf("error unmounting partition '%s': error=%s", node, umountErr.Error()),
+			}
+		}
+	}()
+
+	if _, err := r.Run(runner.Command("btrfs", "filesystem", "resize", strconv.FormatInt(size, 10), btrfsTopLevelDirectory)); err != nil {
+		return &SetupPartitionsError{
+			Err: fmt.Errorf("error shrinking the file system of partition '%s': error=%s", node, err.Error()),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package partition
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Matches a size written as a string, e.g. "1.5GiB", "25%" or "25%FREE"
+var sizeValueRegexp *regexp.Regexp = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*(%(?i:free)?|[A-Za-z]+)$`)
+
+// sizeValue represents a size written as a string, either in bytes or as a
+// percentage of the drive, or of its remaining space when ofFree is true
+type sizeValue struct {
+	bytes   int64
+	percent float64
+	ofFree  bool
+}
+
+// Decodes a PartitionSize written either as an object or as a string, e.g. "512MiB",
+// the string being kept in Value
+// Unknown fields of the object are rejected
+func (p *PartitionSize) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*p = PartitionSize{Value: value}
+		return nil
+	}
+
+	// partitionSize has the same fields without the UnmarshalJSON method
+	type partitionSize PartitionSize
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode((*partitionSize)(p))
+}
+
+// Parses a size written as a string: an amount followed by a supported unit,
+// e.g. "1.5GiB", or a percentage of the drive, e.g. "25%", or a percentage
+// of the remaining space, e.g. "25%FREE"
+func parseSizeValue(value string) (sizeValue, error) {
+	match := sizeValueRegexp.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return sizeValue{}, fmt.Errorf("'%s' should be an amount followed by a unit (e.g. 1.5GiB), a percentage (e.g. 25%%) or a percentage of the remaining space (e.g. 25%%FREE)", value)
+	}
+
+	amount, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return sizeValue{}, err
+	}
+
+	if strings.HasPrefix(match[2], "%") {
+		if amount <= 0 || amount > 100 {
+			return sizeValue{}, fmt.Errorf("'%s' should be a percentage greater than 0 and up to 100", value)
+		}
+		return sizeValue{percent: amount, ofFree: len(match[2]) > 1}, nil
+	}
+
+	exponent := slices.Index(supportedPartitionSizeUnits, match[2]) + 1
+	if exponent == 0 {
+		return sizeValue{}, fmt.Errorf("'%s' has an unsupported unit, it should be one of %s", value, strings.Join(supportedPartitionSizeUnits, ", "))
+	}
+
+	// The units go from KiB (2^10) to YiB (2^80)
+	size := math.Ldexp(amount, 10*exponent)
+	if size >= math.MaxInt64 {
+		return sizeValue{}, fmt.Errorf("'%s' is too big", value)
+	}
+	if size < 1 {
+		return sizeValue{}, fmt.Errorf("'%s' should be greater than 0", value)
+	}
+	return sizeValue{bytes: int64(math.Round(size))}, nil
+}
+
+// Parses a Min or Max bound, which can't be a percentage
+func parseSizeBound(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	parsed, err := parseSizeValue(value)
+	if err != nil {
+		return 0, err
+	}
+	if parsed.bytes == 0 {
+		return 0, fmt.Errorf("'%s' should be an amount followed by a unit, not a percentage", value)
+	}
+	return parsed.bytes, nil
+}
+
+// Returns true if the size can only be known once the drive size is known,
+// in which case sfdisk gets the resolved number of sectors instead of the size
+func (p *PartitionSize) needsResolving() bool {
+	return p.Value != "" || p.Min != "" || p.Max != ""
+}
+
+// Returns the wanted size in bytes, before applying Min and Max, driveSize
+// being the size of the drive and free the space remaining on it
+// Returns false if the size takes the remaining space or isn't valid
+func (p *PartitionSize) wanted(driveSize, free int64) (int64, bool) {
+	if p.Value == "" {
+		return p.Bytes()
+	}
+
+	value, err := parseSizeValue(p.Value)
+	if err != nil {
+		return 0, false
+	}
+	switch {
+	case value.bytes != 0:
+		return value.bytes, true
+	case value.ofFree:
+		return int64(float64(free) * value.percent / 100), true
+	default:
+		return int64(float64(driveSize) * value.percent / 100), true
+	}
+}
+
+// Returns the Min and Max bounds in bytes, 0 when not defined
+func (p *PartitionSize) bounds() (int64, int64) {
+	minimum, _ := parseSizeBound(p.Min)
+	maximum, _ := parseSizeBound(p.Max)
+	return minimum, maximum
+}
@@ -1,21 +1,53 @@
 package partition
 
 import (
-	"errors"
 	"fmt"
-	"os/exec"
+	"math"
+	"path/filepath"
 	"slices"
 	"strings"
+
+	"github.com/october-os/october-installer/pkg/firmware"
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/validation"
 )
 
 const (
 	fileSystemExt4  string = "ext4"
 	fileSystemBtrfs string = "btrfs"
+	fileSystemXfs   string = "xfs"
+	fileSystemF2fs  string = "f2fs"
+	fileSystemVfat  string = "vfat"
+	fileSystemExfat string = "exfat"
 )
 
 var supportedFileSystems []string = []string{
 	fileSystemExt4,
 	fileSystemBtrfs,
+	fileSystemXfs,
+	fileSystemF2fs,
+	fileSystemVfat,
+	fileSystemExfat,
+}
+
+// File systems without Unix permissions and ownership, used to share data with other
+// operating systems, they can't hold the root of the new install
+var sharedFileSystems []string = []string{
+	fileSystemVfat,
+	fileSystemExfat,
+}
+
+// File system of the swap partitions, as written inside fstab
+const fileSystemSwap string = "swap"
+
+// Packages needed by the new install to check and repair each file system,
+// they aren't part of the base system
+var fileSystemPackages map[string]string = map[string]string{
+	fileSystemBtrfs: "btrfs-progs",
+	fileSystemXfs:   "xfsprogs",
+	fileSystemF2fs:  "f2fs-tools",
+	fileSystemVfat:  "dosfstools",
+	fileSystemExfat: "exfatprogs",
 }
 
 const (
@@ -24,6 +56,9 @@ const (
 	gptPartitionTypeRoot       string = "4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709"
 	gptPartitionTypeFileSystem string = "0FC63DAF-8483-4772-8E79-3D69D8477DE4"
 	gptPartitionTypeHome       string = "933AC7E1-2EB4-4F13-B844-0E14E2AEF915"
+	gptPartitionTypeBiosBoot   string = "21686148-6449-6E6F-744E-656564454649"
+	gptPartitionTypeLvm        string = "E6D6D379-F507-44C2-A23C-238F2A3DF928"
+	gptPartitionTypeBasicData  string = "EBD0A0A2-B9E5-4433-87C0-68B6B72699C7"
 )
 
 var supportedGptPartitionTypes []string = []string{
@@ -32,8 +67,50 @@ var supportedGptPartitionTypes []string = []string{
 	gptPartitionTypeRoot,
 	gptPartitionTypeFileSystem,
 	gptPartitionTypeHome,
+	gptPartitionTypeBiosBoot,
+	gptPartitionTypeLvm,
+	gptPartitionTypeBasicData,
+}
+
+// Names of the supported GPT partition types
+var gptPartitionTypeNames map[string]string = map[string]string{
+	gptPartitionTypeEfi:        "EFI System",
+	gptPartitionTypeSwap:       "Linux swap",
+	gptPartitionTypeRoot:       "Linux root (x86-64)",
+	gptPartitionTypeFileSystem: "Linux filesystem",
+	gptPartitionTypeHome:       "Linux home",
+	gptPartitionTypeBiosBoot:   "BIOS boot",
+	gptPartitionTypeLvm:        "Linux LVM",
+	gptPartitionTypeBasicData:  "Microsoft basic data",
+}
+
+// MBR partition types used on DOS partition tables for each supported GPT
+// partition type, the BIOS boot partition only exists on GPT
+// A Microsoft basic data partition formatted with vfat uses "0c" (FAT32 with LBA) instead
+var mbrPartitionTypes map[string]string = map[string]string{
+	gptPartitionTypeEfi:        "ef",
+	gptPartitionTypeSwap:       "82",
+	gptPartitionTypeRoot:       "83",
+	gptPartitionTypeFileSystem: "83",
+	gptPartitionTypeHome:       "83",
+	gptPartitionTypeLvm:        "8e",
+	gptPartitionTypeBasicData:  "07",
 }
 
+const (
+	partitionTableGpt string = "gpt"
+	partitionTableDos string = "dos"
+)
+
+var supportedPartitionTables []string = []string{
+	partitionTableGpt,
+	partitionTableDos,
+}
+
+// A DOS partition table holds at most 4 primary partitions,
+// extended and logical partitions aren't supported
+const dosMaxPartitions int = 4
+
 const (
 	partitionSizeUnitKiB string = "KiB"
 	partitionSizeUnitMiB string = "MiB"
@@ -56,176 +133,594 @@ var supportedPartitionSizeUnits []string = []string{
 	partitionSizeUnitYiB,
 }
 
+// Returns the supported file systems
+func SupportedFileSystems() []string {
+	return slices.Clone(supportedFileSystems)
+}
+
+// Returns the supported GPT partition types
+func SupportedGptPartitionTypes() []string {
+	return slices.Clone(supportedGptPartitionTypes)
+}
+
+// Returns the name of a supported GPT partition type, or an
+// empty string if the partition type isn't supported
+func GptPartitionTypeName(partitionType string) string {
+	return gptPartitionTypeNames[partitionType]
+}
+
+// Returns the supported partition tables
+func SupportedPartitionTables() []string {
+	return slices.Clone(supportedPartitionTables)
+}
+
+// Returns the supported partition size units
+func SupportedPartitionSizeUnits() []string {
+	return slices.Clone(supportedPartitionSizeUnits)
+}
+
 // Drive represents a drive that needs to have partitions added to it
 // Possible attributes values:
 // - Path: the full path of to drive (starting with '/dev/')
+// - EraseAndCreateGpt: erases every signature of the drive (partition table, file system...)
+// and creates a new GPT partition table, so blank and MBR drives can be used; Append must be false
+// - PartitionTable: a partition table present in the supportedPartitionTables slice above,
+// or string default value for GPT
+// - Partitions: the partitions created on the drive, in order, and the existing partitions it reuses
+// - Delete: the existing partitions deleted before the others are shrunk and the new partitions
+// are appended, or nil; Append must be true
+// - Shrink: the existing partitions shrunk before the new partitions are appended, or nil; Append must be true
 type Drive struct {
-	Path       string      `json:"path"`
-	Append     bool        `json:"append"`
-	Partitions []Partition `json:"partitions"`
+	Path              string               `json:"path"`
+	Append            bool                 `json:"append"`
+	EraseAndCreateGpt bool                 `json:"eraseAndCreateGpt"`
+	PartitionTable    string               `json:"partitionTable,omitempty"`
+	Partitions        []Partition          `json:"partitions"`
+	Delete            []PartitionReference `json:"delete,omitempty"`
+	Shrink            []PartitionShrink    `json:"shrink,omitempty"`
+}
+
+// Returns the partition table of the drive, GPT when not defined
+func (d *Drive) partitionTable() string {
+	if d.PartitionTable == "" {
+		return partitionTableGpt
+	}
+	return d.PartitionTable
 }
 
 // Validates the attributes of a Drive struct
-// Returns a ValidationError if validation fails
+// Returns a ValidationError wrapping a validation.Report listing
+// every problem if validation fails
 func (d *Drive) Validate() error {
-	if !strings.HasPrefix(d.Path, "/dev/") {
+	var report validation.Report
+	d.Check("", &report)
+	if !report.Valid() {
 		return &ValidationError{
-			Err: errors.New("Drive validation: error=Path is in the wrong format: should start by '/dev/'"),
+			Err: report.Err(),
+		}
+	}
+	return nil
+}
+
+// Checks the attributes of a Drive struct and its partitions
+// Adds every problem found to the report, path being the JSON path of the drive
+func (d *Drive) Check(path string, report *validation.Report) {
+	if !strings.HasPrefix(d.Path, "/dev/") {
+		report.Add(validation.Field(path, "path"), validation.CodeInvalidFormat, "Path is in the wrong format: should start by '/dev/'")
+	}
+	if d.Append && d.EraseAndCreateGpt {
+		report.Add(validation.Field(path, "eraseAndCreateGpt"), validation.CodeInvalid, "EraseAndCreateGpt can't be used with Append, the existing partitions would be erased")
+	}
+	if d.PartitionTable != "" && !slices.Contains(supportedPartitionTables, d.PartitionTable) {
+		report.Add(validation.Field(path, "partitionTable"), validation.CodeUnsupported, "specified PartitionTable is not supported")
+	}
+	isDos := d.partitionTable() == partitionTableDos
+	if isDos && d.EraseAndCreateGpt {
+		report.Add(validation.Field(path, "eraseAndCreateGpt"), validation.CodeInvalid, "EraseAndCreateGpt can't be used with a DOS partition table")
+	}
+	if len(d.Partitions) == 0 {
+		report.Add(validation.Field(path, "partitions"), validation.CodeRequired, "At least one partition must be defined")
+	}
+	if isDos && len(d.newPartitions()) > dosMaxPartitions {
+		report.Add(validation.Field(path, "partitions"), validation.CodeOutOfRange, fmt.Sprintf("A DOS partition table can't hold more than %d partitions", dosMaxPartitions))
+	}
+	partitionsPath := validation.Field(path, "partitions")
+	for i := range d.Partitions {
+		partitionPath := validation.Index(partitionsPath, i)
+		d.Partitions[i].Check(partitionPath, report)
+		if isDos && d.Partitions[i].PartitionType == gptPartitionTypeBiosBoot {
+			report.Add(validation.Field(partitionPath, "partitionType"), validation.CodeInvalid, "A BIOS boot partition can only be created on a GPT partition table")
+		}
+		if d.Partitions[i].Existing != nil && !d.Append {
+			report.Add(validation.Field(partitionPath, "existing"), validation.CodeInvalid, "The drive must have Append set to keep its existing partitions")
 		}
 	}
-	for _, partition := range d.Partitions {
-		if err := partition.Validate(); err != nil {
-			return err
+
+	deletePath := validation.Field(path, "delete")
+	if len(d.Delete) > 0 && !d.Append {
+		report.Add(deletePath, validation.CodeInvalid, "The drive must have Append set to delete some of its partitions, the others being kept")
+	}
+	for i := range d.Delete {
+		d.Delete[i].Check(validation.Index(deletePath, i), report)
+		if slices.ContainsFunc(d.Delete[:i], func(other PartitionReference) bool { return other.String() == d.Delete[i].String() }) {
+			report.Add(validation.Index(deletePath, i), validation.CodeInvalid, fmt.Sprintf("Partition '%s' is already deleted", d.Delete[i].String()))
+		}
+	}
+
+	shrinkPath := validation.Field(path, "shrink")
+	if len(d.Shrink) > 0 && !d.Append {
+		report.Add(shrinkPath, validation.CodeInvalid, "The drive must have Append set to shrink its existing partitions")
+	}
+	for i := range d.Shrink {
+		d.Shrink[i].Check(validation.Index(shrinkPath, i), report)
+		if slices.ContainsFunc(d.Shrink[:i], func(other PartitionShrink) bool { return other.String() == d.Shrink[i].String() }) {
+			report.Add(validation.Index(shrinkPath, i), validation.CodeInvalid, fmt.Sprintf("Partition '%s' is already shrunk", d.Shrink[i].String()))
 		}
 	}
-	return nil
 }
 
 // Partition represents a drive/disk partition that needs to be created
 // Possible attributes values:
+// - Id: a name used by the volume groups to reference the partition, or string default value
 // - FileSystem: A file system present in the supportedFileSystems slice above, or default string value
 // - PartitionType: a GPT partition type present in the supportedGptPartitionTypes slice above
 // - MountPoint: an absolute Linux filesystem path, or string default value
+// - Subvolumes: the btrfs subvolumes created on the partition and mounted instead of it,
+// or nil; MountPoint must then be string default value
+// - Label: the label of the file system, or string default value
+// - Uuid: the UUID of the file system, a volume ID like "ABCD-1234" for the EFI system partition,
+// or string default value for a random one
+// - MkfsOptions: options given to the mkfs command, written "<option>" or "<option>=<value>",
+// e.g. "-i=16384"; they must be supported by the file system (see supportedMkfsOptions)
+// - MountOptions: options given to mount and written inside fstab, e.g. "noatime";
+// they must be supported by the file system (see supportedMountOptions)
+// - Encryption: the LUKS encryption of the partition, or nil; the EFI system and BIOS boot
+// partitions can't be encrypted
+// - Existing: the partition already on the drive reused instead of creating one, or nil;
+// Size must then be its default value, and the drive must have Append set
+//
+// A Linux LVM partition is neither formatted nor mounted, it is a physical volume
+// of the volume group referencing its Id
 type Partition struct {
-	Size          PartitionSize `json:"size"`
-	FileSystem    string        `json:"fileSystem"`
-	PartitionType string        `json:"partitionType"`
-	MountPoint    string        `json:"mountPoint"`
+	Id            string             `json:"id,omitempty"`
+	Size          PartitionSize      `json:"size"`
+	FileSystem    string             `json:"fileSystem"`
+	PartitionType string             `json:"partitionType"`
+	MountPoint    string             `json:"mountPoint"`
+	Subvolumes    []Subvolume        `json:"subvolumes,omitempty"`
+	Label         string             `json:"label,omitempty"`
+	Uuid          string             `json:"uuid,omitempty"`
+	MkfsOptions   []string           `json:"mkfsOptions,omitempty"`
+	MountOptions  []string           `json:"mountOptions,omitempty"`
+	Encryption    *Encryption        `json:"encryption,omitempty"`
+	Existing      *ExistingPartition `json:"existing,omitempty"`
 }
 
-// Transforms a partition into its sfdisk format
+// Transforms a partition into its sfdisk format for the given partition table
+// The partition starts where Fit placed it, so sfdisk creates it in the same
+// free region, and sizes needing the drive size to be known are written as
+// the number of sectors resolved by Fit
+// On a DOS partition table, the MBR partition type is used and the partition
+// can be marked as bootable
 // Returns a string
 //
 // Example:
-// "type=C12A7328-F81F-11D2-BA4B-00A0C93EC93B, size=1GiB"
-func (p *Partition) toSfdiskFormat() string {
-	partition_string := fmt.Sprintf("type=%s", p.PartitionType)
-	if p.Size.TakeRemaining {
+// "start=2048, type=C12A7328-F81F-11D2-BA4B-00A0C93EC93B, size=1GiB"
+// "start=2099200, type=83, size=+, bootable"
+func (p *Partition) toSfdiskFormat(fit PartitionFit, sectorSize int64, partitionTable string, bootable bool) string {
+	partitionType := p.PartitionType
+	if partitionTable == partitionTableDos {
+		partitionType = mbrPartitionTypes[p.PartitionType]
+		if p.PartitionType == gptPartitionTypeBasicData && p.FileSystem == fileSystemVfat {
+			partitionType = "0c"
+		}
+	}
+	partition_string := fmt.Sprintf("start=%d, type=%s", fit.Start/sectorSize, partitionType)
+	if p.Size.needsResolving() {
+		partition_string += fmt.Sprintf(", size=%d", fit.Sectors)
+	} else if p.Size.TakeRemaining {
 		partition_string += ", size=+"
 	} else {
 		partition_string += fmt.Sprintf(", size=%d%s", p.Size.Amount, p.Size.Unit)
 	}
+	if bootable {
+		partition_string += ", bootable"
+	}
 	return partition_string
 }
 
-// Returns the command that can be used to format the partition
+// Returns the command that can be used to format the partition, with
+// its Label, Uuid and MkfsOptions (see mkfsCommands)
 // Can return one type of error: SetupPartitionsError
-func (p *Partition) formatCommand(path string) (*exec.Cmd, error) {
-	switch p.PartitionType {
-	case gptPartitionTypeEfi:
-		return exec.Command("mkfs.fat", "-F", "32", path), nil
-	case gptPartitionTypeSwap:
-		return exec.Command("mkswap", path), nil
-	case gptPartitionTypeRoot, gptPartitionTypeHome, gptPartitionTypeFileSystem:
-		switch p.FileSystem {
-		case fileSystemExt4:
-			return exec.Command("mkfs.ext4", path), nil
-		case fileSystemBtrfs:
-			return exec.Command("mkfs.btrfs", path), nil
-		}
+func (p *Partition) formatCommand(path string) (runner.Cmd, error) {
+	if c, found := mkfsCommands[p.fileSystem()]; found && p.needsFormatting() {
+		return c.command(p, path), nil
 	}
 
-	return nil, &SetupPartitionsError{
+	return runner.Cmd{}, &SetupPartitionsError{
 		Err: fmt.Errorf("error choosing a formatting command: unsupported file system or partition type"),
 	}
 }
 
-// Returns the command that can be used to mount the partition
-// Can return one type of error: SetupPartitionsError
-func (p *Partition) mountCommand(path string) (*exec.Cmd, error) {
-	switch p.PartitionType {
+// Checks that a partition formatted with vfat or exfat doesn't hold /,
+// path being the JSON path of the partition
+func (p *Partition) checkSharedFileSystem(path string, report *validation.Report) {
+	if !slices.Contains(sharedFileSystems, p.FileSystem) {
+		return
+	}
+	for _, m := range p.mountPoints(path) {
+		if m.mountPoint == "/" {
+			report.Add(validation.Field(path, "fileSystem"), validation.CodeInvalid, fmt.Sprintf("/ can't be formatted with %s, it has no Unix permissions", p.FileSystem))
+		}
+	}
+}
+
+// Returns true if the FileSystem of the partition needs to be defined
+// The EFI and swap partitions get their own format, the BIOS boot and Linux LVM partitions aren't formatted
+func (p *Partition) NeedsFileSystem() bool {
+	return p.PartitionType != gptPartitionTypeEfi && p.PartitionType != gptPartitionTypeSwap && p.needsFormatting()
+}
+
+// Returns true if the partition needs to be formatted
+// The BIOS boot partition holds the Grub core image as raw data, the Linux LVM
+// partition holds the logical volumes, which get formatted instead
+func (p *Partition) needsFormatting() bool {
+	return p.PartitionType != gptPartitionTypeBiosBoot && p.PartitionType != gptPartitionTypeLvm
+}
+
+// Returns true if the MountPoint of the partition needs to be defined
+// Swap partitions aren't mounted, so they don't need one
+func (p *Partition) NeedsMountPoint() bool {
+	return p.PartitionType == gptPartitionTypeEfi || p.PartitionType == gptPartitionTypeRoot
+}
+
+// Returns true if the partition is a swap partition
+func (p *Partition) IsSwap() bool {
+	return p.PartitionType == gptPartitionTypeSwap
+}
+
+// Returns true if the partition can be encrypted
+// The firmware reads the EFI system and BIOS boot partitions, they can't be encrypted
+func (p *Partition) CanBeEncrypted() bool {
+	return p.PartitionType != gptPartitionTypeEfi && !p.IsBiosBoot()
+}
+
+// Returns true if the partition is a BIOS boot partition
+// It is neither formatted nor mounted
+func (p *Partition) IsBiosBoot() bool {
+	return p.PartitionType == gptPartitionTypeBiosBoot
+}
+
+// Returns true if the partition is a Linux LVM partition
+// It is neither formatted nor mounted, it holds logical volumes
+func (p *Partition) IsLvm() bool {
+	return p.PartitionType == gptPartitionTypeLvm
+}
+
+// Mount point of the partition holding the kernels and the Grub files,
+// / holds them when there is no such partition
+const bootMountPoint string = "/boot"
+
+// mountPointPath represents a mount point of a partition and its JSON path
+type mountPointPath struct {
+	mountPoint string
+	path       string
+}
+
+// Returns the clean absolute mount points of the partition, its MountPoint or the
+// MountPoint of its subvolumes, with their JSON path, path being the JSON path of the partition
+func (p *Partition) mountPoints(path string) []mountPointPath {
+	var mountPoints []mountPointPath
+	if filepath.IsAbs(p.MountPoint) {
+		mountPoints = append(mountPoints, mountPointPath{filepath.Clean(p.MountPoint), validation.Field(path, "mountPoint")})
+	}
+	for i, s := range p.Subvolumes {
+		if filepath.IsAbs(s.MountPoint) {
+			subvolumePath := validation.Index(validation.Field(path, "subvolumes"), i)
+			mountPoints = append(mountPoints, mountPointPath{filepath.Clean(s.MountPoint), validation.Field(subvolumePath, "mountPoint")})
+		}
+	}
+	return mountPoints
+}
+
+// Returns true if the partition, or one of its subvolumes, is mounted at mountPoint
+func (p *Partition) holds(mountPoint string) bool {
+	return slices.ContainsFunc(p.mountPoints(""), func(m mountPointPath) bool {
+		return m.mountPoint == mountPoint
+	})
+}
+
+// Returns the mount point closest to '/' of the partition or of its
+// subvolumes, or an empty string if it isn't mounted
+func (p *Partition) mainMountPoint() string {
+	mountPoint := ""
+	for _, m := range p.mountPoints("") {
+		if mountPoint == "" || mountPointDepth(m.mountPoint) < mountPointDepth(mountPoint) {
+			mountPoint = m.mountPoint
+		}
+	}
+	return mountPoint
+}
+
+// Returns the mount point usually used for the partition type,
+// or an empty string if there is none
+func DefaultMountPoint(partitionType string) string {
+	switch partitionType {
 	case gptPartitionTypeEfi:
-		return exec.Command("mount", "--mkdir", path, "/mnt/boot"), nil
-	case gptPartitionTypeSwap:
-		return exec.Command("swapon", path), nil
+		return bootMountPoint
 	case gptPartitionTypeRoot:
-		return exec.Command("mount", path, "/mnt"), nil
-	case gptPartitionTypeHome, gptPartitionTypeFileSystem:
-		return exec.Command("mount", "--mkdir", path, p.MountPoint), nil
+		return "/"
+	case gptPartitionTypeHome:
+		return "/home"
 	}
+	return ""
+}
 
-	return nil, &SetupPartitionsError{
-		Err: fmt.Errorf("error choosing a mounting command: unsupported partition type"),
+// Returns the partitions of the recommended layout for the firmware: a 1 GiB
+// EFI system partition on UEFI or a 1 MiB BIOS boot partition on BIOS, a swap
+// partition of swapSize GiB (none if swapSize is 0) and an ext4 root partition
+// taking the rest of the drive
+func RecommendedPartitions(swapSize int, mode firmware.Mode) []Partition {
+	partitions := []Partition{{
+		Size:          PartitionSize{Amount: 1, Unit: partitionSizeUnitGiB},
+		PartitionType: gptPartitionTypeEfi,
+		MountPoint:    DefaultMountPoint(gptPartitionTypeEfi),
+	}}
+	if mode == firmware.Bios {
+		partitions = []Partition{{
+			Size:          PartitionSize{Amount: 1, Unit: partitionSizeUnitMiB},
+			PartitionType: gptPartitionTypeBiosBoot,
+		}}
 	}
+
+	if swapSize > 0 {
+		partitions = append(partitions, Partition{
+			Size:          PartitionSize{Amount: swapSize, Unit: partitionSizeUnitGiB},
+			PartitionType: gptPartitionTypeSwap,
+		})
+	}
+
+	return append(partitions, Partition{
+		Size:          PartitionSize{TakeRemaining: true},
+		FileSystem:    fileSystemExt4,
+		PartitionType: gptPartitionTypeRoot,
+		MountPoint:    DefaultMountPoint(gptPartitionTypeRoot),
+	})
 }
 
 // Validates the attributes of a Partition struct
-// Returns a ValidationError if validation fails
+// Returns a ValidationError wrapping a validation.Report listing
+// every problem if validation fails
 func (p *Partition) Validate() error {
+	var report validation.Report
+	p.Check("", &report)
+	if !report.Valid() {
+		return &ValidationError{
+			Err: report.Err(),
+		}
+	}
+	return nil
+}
+
+// Checks the attributes of a Partition struct and its size
+// Adds every problem found to the report, path being the JSON path of the partition
+func (p *Partition) Check(path string, report *validation.Report) {
+	mountPointPath := validation.Field(path, "mountPoint")
+	fileSystemPath := validation.Field(path, "fileSystem")
+
 	if p.MountPoint != "" {
 		if !strings.HasPrefix(p.MountPoint, "/") {
-			return &ValidationError{
-				Err: errors.New("Partition validation: error=MountPoint is in the wrong format: should start by '/'"),
-			}
+			report.Add(mountPointPath, validation.CodeInvalidFormat, "MountPoint is in the wrong format: should start by '/'")
 		}
 	}
 	if !slices.Contains(supportedGptPartitionTypes, p.PartitionType) {
-		return &ValidationError{
-			Err: errors.New("Partition validation: error=specified PartitionType is not supported"),
-		}
+		report.Add(validation.Field(path, "partitionType"), validation.CodeUnsupported, "specified PartitionType is not supported")
 	}
 	if p.FileSystem != "" {
 		if !slices.Contains(supportedFileSystems, p.FileSystem) {
-			return &ValidationError{
-				Err: errors.New("Partition validation: error=specified FileSystem is not supported"),
-			}
+			report.Add(fileSystemPath, validation.CodeUnsupported, "specified FileSystem is not supported")
 		}
 	}
 
 	if p.FileSystem == "" {
-		if p.PartitionType != gptPartitionTypeEfi && p.PartitionType != gptPartitionTypeSwap {
-			return &ValidationError{
-				Err: errors.New("Partition validation: error=Filesystem is not defined, but the partition type needs a file system"),
-			}
+		if p.NeedsFileSystem() {
+			report.Add(fileSystemPath, validation.CodeRequired, "Filesystem is not defined, but the partition type needs a file system")
 		}
 	}
 
-	if p.MountPoint == "" {
-		if p.PartitionType == gptPartitionTypeEfi || p.PartitionType == gptPartitionTypeSwap || p.PartitionType == gptPartitionTypeRoot {
-			return &ValidationError{
-				Err: errors.New("Partition validation: error=MountPoint is not defined, but the partition type needs a mount point"),
-			}
+	if p.MountPoint == "" && len(p.Subvolumes) == 0 {
+		if p.NeedsMountPoint() {
+			report.Add(mountPointPath, validation.CodeRequired, "MountPoint is not defined, but the partition type needs a mount point")
 		}
 	}
 
-	return p.Size.Validate()
+	if p.IsBiosBoot() {
+		if p.FileSystem != "" {
+			report.Add(fileSystemPath, validation.CodeInvalid, "A BIOS boot partition isn't formatted, it can't have a FileSystem")
+		}
+		if p.MountPoint != "" {
+			report.Add(mountPointPath, validation.CodeInvalid, "A BIOS boot partition isn't mounted, it can't have a MountPoint")
+		}
+	}
+
+	checkSubvolumes(path, p.Subvolumes, p.FileSystem, p.MountPoint, report)
+	if p.FileSystem == "" || slices.Contains(supportedFileSystems, p.FileSystem) {
+		p.checkFormatOptions(path, report)
+		p.checkSharedFileSystem(path, report)
+	}
+	if p.PartitionType == gptPartitionTypeBasicData && p.FileSystem != "" && !slices.Contains(sharedFileSystems, p.FileSystem) {
+		report.Add(fileSystemPath, validation.CodeInvalid, "A Microsoft basic data partition is shared with other operating systems, it must be formatted with vfat or exfat")
+	}
+
+	if p.IsLvm() {
+		if p.FileSystem != "" {
+			report.Add(fileSystemPath, validation.CodeInvalid, "A Linux LVM partition isn't formatted, its logical volumes are, it can't have a FileSystem")
+		}
+		if p.MountPoint != "" {
+			report.Add(mountPointPath, validation.CodeInvalid, "A Linux LVM partition isn't mounted, its logical volumes are, it can't have a MountPoint")
+		}
+	}
+	if p.Id != "" && !volumeNameRegexp.MatchString(p.Id) {
+		report.Add(validation.Field(path, "id"), validation.CodeInvalidFormat, "Id is in the wrong format: should be letters, digits, '_', '.', '+' or '-'")
+	}
+
+	if p.Encryption != nil {
+		encryptionPath := validation.Field(path, "encryption")
+		if !p.CanBeEncrypted() {
+			report.Add(encryptionPath, validation.CodeInvalid, "The EFI system and BIOS boot partitions can't be encrypted, the firmware reads them")
+		} else if p.mapperName() == "" {
+			report.Add(validation.Field(encryptionPath, "label"), validation.CodeRequired, "Label is not defined, but the encrypted partition has no mount point to name its mapped device after")
+		}
+		p.Encryption.Check(encryptionPath, report)
+	}
+
+	if p.Existing != nil {
+		p.checkExisting(path, report)
+	} else {
+		p.Size.Check(validation.Field(path, "size"), report)
+	}
+}
+
+// MappedPartition represents a Partition and the device node
+// of the partition created for it on the system
+type MappedPartition struct {
+	Partition Partition `json:"partition"`
+	Node      string    `json:"node"`
+	// Drive is the path of the drive the partition was created on, empty for a logical volume
+	Drive string `json:"drive"`
+	// VolumeGroup is the name of the volume group the partition is a physical volume of,
+	// or the logical volume is created in
+	VolumeGroup string `json:"volumeGroup,omitempty"`
+	// LogicalVolume is set when the entry is a logical volume instead of a partition,
+	// Node being its device, e.g. /dev/vg0/root
+	LogicalVolume *LogicalVolume `json:"logicalVolume,omitempty"`
+}
+
+// Layout represents every partition created on the drives,
+// in the same order as they are defined in the drives, followed
+// by the logical volumes of the volume groups (see MapVolumeGroups)
+type Layout []MappedPartition
+
+// Returns the mount point of the EFI system partition inside
+// the new install, or an empty string if there is none
+func (l Layout) EfiMountPoint() string {
+	for _, mapped := range l {
+		if mapped.Partition.PartitionType == gptPartitionTypeEfi && filepath.IsAbs(mapped.Partition.MountPoint) {
+			return filepath.Clean(mapped.Partition.MountPoint)
+		}
+	}
+	return ""
+}
+
+// Returns the path of the drive holding /boot, or / when /boot isn't a
+// separate partition, Grub being installed on it on BIOS
+// Returns an empty string if there is none
+func (l Layout) BootDrive() string {
+	var partitions []Partition
+	for _, mapped := range l {
+		partitions = append(partitions, mapped.Partition)
+	}
+	if i := bootPartitionIndex(partitions); i >= 0 {
+		return l[i].Drive
+	}
+	return ""
 }
 
 // PartitionSize represents the size of a Partition
 // Possible attributes values:
 // Amount: any positive integer greater or equal 1, or int default value
 // Unit: a partition size unit present in the supportedPartitionSizeUnits slice above, or string default value
-// TakeRemaining: true/false, if false: Amount and Unit must not be default int/string values
+// TakeRemaining: true/false, if false: Amount and Unit must not be default int/string values, unless Value is defined
+// Value: a size written as a string, e.g. "1.5GiB", "25%" of the drive or "25%FREE" of the remaining space,
+// or string default value; it can't be used with Amount, Unit and TakeRemaining
+// Min, Max: bounds written as a string, e.g. "20GiB", or string default value
+//
+// The size can also be written as a string in JSON, e.g. "size": "512MiB", which sets Value
 type PartitionSize struct {
 	Amount        int    `json:"amount"`
 	Unit          string `json:"unit"`
 	TakeRemaining bool   `json:"takeRemaining"`
+	Value         string `json:"value,omitempty"`
+	Min           string `json:"min,omitempty"`
+	Max           string `json:"max,omitempty"`
+}
+
+// Returns the size in bytes
+// Returns false if the size takes the remaining space or is a percentage, its unit
+// isn't supported, or it is too big to be written in bytes as an int64
+func (p *PartitionSize) Bytes() (int64, bool) {
+	if p.Value != "" {
+		value, err := parseSizeValue(p.Value)
+		return value.bytes, err == nil && value.bytes != 0
+	}
+
+	exponent := slices.Index(supportedPartitionSizeUnits, p.Unit) + 1
+	if p.TakeRemaining || exponent == 0 || p.Amount < 0 {
+		return 0, false
+	}
+
+	// The units go from KiB (2^10) to YiB (2^80)
+	shift := 10 * exponent
+	if shift >= 63 || int64(p.Amount) > math.MaxInt64>>shift {
+		return 0, false
+	}
+	return int64(p.Amount) << shift, true
 }
 
 // Validates the attributes of a PartitionSize struct
-// Returns a ValidationError if validation fails
+// Returns a ValidationError wrapping a validation.Report listing
+// every problem if validation fails
 func (p *PartitionSize) Validate() error {
-	if p.TakeRemaining == false && (p.Amount == 0 || p.Unit == "") {
+	var report validation.Report
+	p.Check("", &report)
+	if !report.Valid() {
 		return &ValidationError{
-			Err: errors.New("PartitionSize validation: error=TakeRemaining is false but Amount and/or Unit are not defined"),
+			Err: report.Err(),
+		}
+	}
+	return nil
+}
+
+// Checks the attributes of a PartitionSize struct
+// Adds every problem found to the report, path being the JSON path of the size
+func (p *PartitionSize) Check(path string, report *validation.Report) {
+	if p.Value != "" {
+		if p.Amount != 0 || p.Unit != "" || p.TakeRemaining {
+			report.Add(validation.Field(path, "value"), validation.CodeInvalid, "Value can't be used with Amount, Unit or TakeRemaining")
+		}
+		if _, err := parseSizeValue(p.Value); err != nil {
+			report.Add(validation.Field(path, "value"), validation.CodeInvalidFormat, err.Error())
+		}
+	} else if p.TakeRemaining == false {
+		if p.Amount == 0 {
+			report.Add(validation.Field(path, "amount"), validation.CodeRequired, "TakeRemaining is false but Amount is not defined")
+		}
+		if p.Unit == "" {
+			report.Add(validation.Field(path, "unit"), validation.CodeRequired, "TakeRemaining is false but Unit is not defined")
 		}
 	}
 
 	if p.Amount != 0 {
 		if p.Amount < 1 {
-			return &ValidationError{
-				Err: errors.New("PartitionSize validation: error=Amount must be greater or equal 1"),
-			}
+			report.Add(validation.Field(path, "amount"), validation.CodeOutOfRange, "Amount must be greater or equal 1")
 		}
 	}
 
 	if p.Unit != "" {
 		if !slices.Contains(supportedPartitionSizeUnits, p.Unit) {
-			return &ValidationError{
-				Err: errors.New("PartitionSize validation: error=specified Unit is not supported"),
-			}
+			report.Add(validation.Field(path, "unit"), validation.CodeUnsupported, "specified Unit is not supported")
 		}
 	}
 
-	return nil
+	minimum, minErr := parseSizeBound(p.Min)
+	if minErr != nil {
+		report.Add(validation.Field(path, "min"), validation.CodeInvalidFormat, minErr.Error())
+	}
+	maximum, maxErr := parseSizeBound(p.Max)
+	if maxErr != nil {
+		report.Add(validation.Field(path, "max"), validation.CodeInvalidFormat, maxErr.Error())
+	}
+	if minErr == nil && maxErr == nil && minimum != 0 && maximum != 0 && minimum > maximum {
+		report.Add(validation.Field(path, "max"), validation.CodeOutOfRange, "Max must be greater or equal Min")
+	}
 }
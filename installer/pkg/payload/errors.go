@@ -0,0 +1,21 @@
+package payload
+
+import "fmt"
+
+// PayloadError represents an error that occured while
+// reading or validating the installation payload.
+type PayloadError struct {
+	Err error
+}
+
+// Error returns a formatted error message containing the
+// original error message inside.
+func (e PayloadError) Error() string {
+	return fmt.Sprintf("Payload error: error=%s", e.Err.Error())
+}
+
+// Unwrap returns the original error wrapped inside
+// PayloadError.
+func (e PayloadError) Unwrap() error {
+	return e.Err
+}
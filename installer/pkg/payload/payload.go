@@ -0,0 +1,184 @@
+// Package payload provides the struct representing the JSON document
+// that describes a whole installation (see doc/payload.md) and the
+// functions to decode and validate it.
+package payload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/october-os/october-installer/pkg/firmware"
+	"github.com/october-os/october-installer/pkg/hostname"
+	"github.com/october-os/october-installer/pkg/locale"
+	"github.com/october-os/october-installer/pkg/mirrors"
+	"github.com/october-os/october-installer/pkg/partition"
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/timezone"
+	"github.com/october-os/october-installer/pkg/user"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+// Payload represents everything needed to install a new system.
+type Payload struct {
+	Drives       []partition.Drive       `json:"drives"`
+	VolumeGroups []partition.VolumeGroup `json:"volumeGroups,omitempty"`
+	Users        []user.User             `json:"users"`
+	Mirrors      []string                `json:"mirrors"`
+	Timezone     string                  `json:"timezone"`
+	Locale       string                  `json:"locale"`
+	Hostname     string                  `json:"hostname"`
+	RootPassword string                  `json:"rootpassword"`
+}
+
+// Decodes a JSON payload read from r. Unknown fields are
+// rejected so that typos don't get silently ignored.
+//
+// Can return error types:
+//   - PayloadError
+func Decode(r io.Reader) (*Payload, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	var p Payload
+	if err := decoder.Decode(&p); err != nil {
+		return nil, PayloadError{
+			Err: fmt.Errorf("could not decode payload: %w", err),
+		}
+	}
+
+	return &p, nil
+}
+
+// Validates every part of the payload using the Check and Validate
+// functions of each package. Every problem is collected instead of
+// stopping at the first one.
+//
+// Users without a home path get the default one set.
+//
+// Can return error types:
+//   - *validation.Report
+func (p *Payload) Validate(r runner.Runner) error {
+	return p.Check(r).Err()
+}
+
+// Checks every part of the payload and returns the report
+// listing all the problems found. The runner is used to query
+// the firmware of the machine, the size of the drives and the valid
+// mirror countries, timezones and locales.
+//
+// Users without a home path get the default one set.
+func (p *Payload) Check(r runner.Runner) *validation.Report {
+	var report validation.Report
+
+	if len(p.Drives) == 0 {
+		report.Add("drives", validation.CodeRequired, "At least one drive must be specified")
+	}
+	for i := range p.Drives {
+		p.Drives[i].Check(validation.Index("drives", i), &report)
+	}
+	mode, err := firmware.Detect(r)
+	if err != nil {
+		report.Add("drives", validation.CodeCheckFailed, err.Error())
+	} else {
+		partition.CheckLayout("", p.Drives, p.VolumeGroups, mode, &report)
+	}
+	if report.Valid() {
+		// Only the drives were checked so far, their sizes are only
+		// worth checking once their partitions are valid
+		partition.CheckFit(r, "drives", p.Drives, &report)
+	}
+
+	for i := range p.Users {
+		p.Users[i].Check(validation.Index("users", i), &report)
+	}
+
+	if strings.TrimSpace(p.RootPassword) == "" {
+		report.Add("rootpassword", validation.CodeRequired, "Root password can't be empty")
+	}
+
+	for i, country := range p.Mirrors {
+		checkValue(&report, validation.Index("mirrors", i), country, mirrors.ErrInvalidCountry, func(country string) error {
+			return mirrors.ValidateCountry(r, country)
+		})
+	}
+	checkValue(&report, "timezone", p.Timezone, timezone.ErrInvalidTimezone, func(tz string) error {
+		return timezone.ValidateTimezone(r, tz)
+	})
+	checkValue(&report, "locale", p.Locale, locale.ErrInvalidLocale, func(l string) error {
+		return locale.ValidateLocale(r, l)
+	})
+	checkValue(&report, "hostname", p.Hostname, hostname.ErrInvalidHostname, hostname.ValidateHostname)
+
+	return &report
+}
+
+// Checks a single required string value with the given validate function.
+//
+// A validate error wrapping invalidErr means the value is invalid, any
+// other error means the value couldn't be checked.
+func checkValue(report *validation.Report, path, value string, invalidErr error, validate func(string) error) {
+	if strings.TrimSpace(value) == "" {
+		report.Add(path, validation.CodeRequired, "Value can't be empty")
+		return
+	}
+
+	err := validate(value)
+	if err == nil {
+		return
+	}
+
+	if errors.Is(err, invalidErr) {
+		report.Add(path, validation.CodeInvalid, invalidErr.Error())
+	} else {
+		report.Add(path, validation.CodeCheckFailed, err.Error())
+	}
+}
+
+// Returns the hex SHA-256 digest of the payload encoded in JSON,
+// without its passphrases and passwords. Used to make sure an
+// installation is resumed with the same payload.
+//
+// The digest is saved inside the journal: hashing the secrets would
+// let anyone reading it check guesses of them.
+func (p *Payload) Digest() string {
+	content, _ := json.Marshal(p.WithoutPassphrases())
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns a copy of the payload without the passphrases of the
+// encrypted partitions, the user passwords and the root password.
+func (p *Payload) WithoutPassphrases() *Payload {
+	withoutPassphrases := *p
+
+	withoutPassphrases.Drives = make([]partition.Drive, len(p.Drives))
+	for i, drive := range p.Drives {
+		withoutPassphrases.Drives[i] = drive.WithoutPassphrases()
+	}
+
+	withoutPassphrases.Users = slices.Clone(p.Users)
+	for i := range withoutPassphrases.Users {
+		withoutPassphrases.Users[i].Password = ""
+	}
+	withoutPassphrases.RootPassword = ""
+
+	return &withoutPassphrases
+}
+
+// Returns true if at least one of the users needs
+// to be a sudoer.
+func (p *Payload) HasSudoer() bool {
+	for _, u := range p.Users {
+		if u.Sudoer {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,74 @@
+// Package plan provides the Recorder, a runner.Runner recording every
+// command and file write of an install instead of executing them, and
+// the Plan it produces.
+//
+// Read-only commands are still executed on the machine so the plan
+// reflects the real state of the drives.
+package plan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of action found in a plan.
+const (
+	// KindQuery is a read-only command executed on the live system.
+	KindQuery string = "query"
+	// KindCommand is a command changing the state of the live system.
+	KindCommand string = "command"
+	// KindChroot is a shell command executed inside the new install.
+	KindChroot string = "chroot"
+	// KindFile is a file written on the live system.
+	KindFile string = "file"
+)
+
+// Action represents one thing the install would do.
+//
+// Command is the shell-quoted command line for commands and the shell
+// command for chroot actions. Input is what is fed to the command
+// through STDIN, or the content of the file.
+type Action struct {
+	Step    string `json:"step"`
+	Kind    string `json:"kind"`
+	Command string `json:"command,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Input   string `json:"input,omitempty"`
+}
+
+// Plan represents every action of an install, in order.
+type Plan struct {
+	Actions []Action `json:"actions"`
+}
+
+// Returns the plan in a human-readable format: the actions are
+// numbered and grouped by installation step.
+func (p *Plan) String() string {
+	var b strings.Builder
+	lastStep := ""
+
+	for i, action := range p.Actions {
+		if i == 0 || action.Step != lastStep {
+			if i != 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "[%s]\n", action.Step)
+			lastStep = action.Step
+		}
+
+		switch action.Kind {
+		case KindFile:
+			fmt.Fprintf(&b, "%4d  %-7s %s\n", i+1, action.Kind, action.Path)
+		default:
+			fmt.Fprintf(&b, "%4d  %-7s %s\n", i+1, action.Kind, action.Command)
+		}
+
+		if action.Input != "" {
+			for _, line := range strings.Split(strings.TrimSuffix(action.Input, "\n"), "\n") {
+				fmt.Fprintf(&b, "%15s %s\n", "|", line)
+			}
+		}
+	}
+
+	return b.String()
+}
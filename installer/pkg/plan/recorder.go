@@ -0,0 +1,308 @@
+package plan
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/october-os/october-installer/pkg/runner"
+)
+
+// Recorder is a runner.Runner that records commands changing the
+// machine and file writes instead of executing them. Read-only
+// commands and file reads are executed by the wrapped Runner and
+// recorded too.
+//
+// Since partitions are never created, the Recorder simulates the
+// output of 'sfdisk --json <drive>' after the drive got partitioned,
+// and the output of blkid for the partitions it would have created,
+// the encrypted devices it would have opened and the existing partitions
+// it would have formatted, so the rest of the install can be planned.
+type Recorder struct {
+	plan Plan
+	step string
+	live runner.Runner
+
+	// states holds the last real 'sfdisk --json' output of each drive
+	states map[string]string
+	// partitioned holds the sfdisk runs of each drive
+	partitioned map[string]sfdiskRun
+	// created holds the nodes of the partitions that would have been created,
+	// of the encrypted devices that would have been opened and of the
+	// partitions that would have been formatted
+	created map[string]bool
+}
+
+// Redacted is recorded instead of the secrets fed to a command,
+// e.g. the passwords and the LUKS passphrases.
+const Redacted string = "<redacted>"
+
+// Directory of the devices opened by 'cryptsetup open <node> <name>'
+const mapperDirectory string = "/dev/mapper"
+
+// sfdiskRun represents the sfdisk commands that would have
+// partitioned a drive.
+type sfdiskRun struct {
+	append     bool
+	partitions int
+	// deleted holds the numbers of the partitions deleted
+	// by 'sfdisk --delete <drive> <number>...'
+	deleted []int
+}
+
+// sfdiskState is the part of 'sfdisk --json' read by the Recorder.
+type sfdiskState struct {
+	PartitionTable struct {
+		Device     string            `json:"device"`
+		Partitions []sfdiskPartition `json:"partitions"`
+	} `json:"partitiontable"`
+}
+
+// sfdiskPartition is a partition listed by 'sfdisk --json'.
+type sfdiskPartition struct {
+	Node string `json:"node"`
+}
+
+// Returns a new empty Recorder executing the read-only
+// commands with live.
+func NewRecorder(live runner.Runner) *Recorder {
+	return &Recorder{
+		live:        live,
+		states:      make(map[string]string),
+		partitioned: make(map[string]sfdiskRun),
+		created:     make(map[string]bool),
+	}
+}
+
+// Sets the installation step the next actions belong to.
+func (r *Recorder) Step(name string) {
+	r.step = name
+}
+
+// Returns the plan recorded so far.
+func (r *Recorder) Plan() *Plan {
+	return &r.plan
+}
+
+// Records the command without running it.
+func (r *Recorder) Run(cmd runner.Cmd) (runner.Result, error) {
+	if cmd.Name == "sfdisk" {
+		r.recordSfdisk(cmd.Args, cmd.Stdin)
+	}
+	if cmd.Name == "cryptsetup" && len(cmd.Args) > 0 && cmd.Args[0] == "open" {
+		r.created[mapperDirectory+"/"+cmd.Args[len(cmd.Args)-1]] = true
+	}
+	if cmd.Name == "lvcreate" && len(cmd.Args) > 0 {
+		r.recordLvcreate(cmd.Args)
+	}
+	if (strings.HasPrefix(cmd.Name, "mkfs.") || cmd.Name == "mkswap") && len(cmd.Args) > 0 {
+		// The file system gets a new UUID
+		r.created[cmd.Args[len(cmd.Args)-1]] = true
+	}
+
+	r.add(Action{Kind: KindCommand, Command: cmd.String(), Input: recordedInput(cmd)})
+	return runner.Result{}, nil
+}
+
+// Runs the read-only command with the live Runner and records it.
+// The output of 'sfdisk --json <drive>' is simulated for
+// partitioned drives, and the output of blkid for created partitions.
+func (r *Recorder) Query(cmd runner.Cmd) (runner.Result, error) {
+	r.add(Action{Kind: KindQuery, Command: cmd.String(), Input: recordedInput(cmd)})
+
+	if cmd.Name == "blkid" && len(cmd.Args) > 0 && r.created[cmd.Args[len(cmd.Args)-1]] {
+		return simulateBlkid(cmd.Args), nil
+	}
+
+	isSfdiskJson := cmd.Name == "sfdisk" && len(cmd.Args) == 2 && cmd.Args[0] == "--json"
+	if isSfdiskJson {
+		if run, found := r.partitioned[cmd.Args[1]]; found {
+			return r.simulateSfdiskJson(cmd.Args[1], run)
+		}
+	}
+
+	result, err := r.live.Query(cmd)
+	if err == nil && isSfdiskJson {
+		r.states[cmd.Args[1]] = result.Stdout
+	}
+
+	return result, err
+}
+
+// Records the command without running it. Shell commands are
+// recorded without the shell around them.
+func (r *Recorder) RunInChroot(root string, cmd runner.Cmd) (runner.Result, error) {
+	command := cmd.String()
+	if len(cmd.Args) == 2 && cmd.Args[0] == "-c" {
+		command = cmd.Args[1]
+	}
+
+	r.add(Action{Kind: KindChroot, Command: command, Input: recordedInput(cmd)})
+	return runner.Result{}, nil
+}
+
+// Reads the file with the live Runner.
+func (r *Recorder) ReadFile(path string) ([]byte, error) {
+	return r.live.ReadFile(path)
+}
+
+// Records the file write without writing it.
+func (r *Recorder) WriteFile(path string, data []byte) error {
+	r.add(Action{Kind: KindFile, Path: path, Input: string(data)})
+	return nil
+}
+
+// Returns what is fed to the command through STDIN as it is recorded,
+// secrets being replaced by Redacted.
+func recordedInput(cmd runner.Cmd) string {
+	if cmd.Secret && cmd.Stdin != "" {
+		return Redacted
+	}
+	return cmd.Stdin
+}
+
+// Adds the action to the plan under the current step.
+func (r *Recorder) add(action Action) {
+	action.Step = r.step
+	r.plan.Actions = append(r.plan.Actions, action)
+}
+
+// Remembers how many partitions an 'sfdisk [-a] <drive>'
+// command would have created from its script.
+func (r *Recorder) recordSfdisk(args []string, script string) {
+	if len(args) == 0 || strings.HasPrefix(args[len(args)-1], "-") {
+		return
+	}
+	if slices.Contains(args, "-N") || slices.Contains(args, "--partno") {
+		// An existing partition is changed, none is created
+		return
+	}
+	if len(args) > 2 && args[0] == "--delete" {
+		r.recordSfdiskDelete(args[1], args[2:])
+		return
+	}
+
+	run := sfdiskRun{}
+	for _, arg := range args[:len(args)-1] {
+		if arg == "-a" || arg == "--append" {
+			run.append = true
+		}
+	}
+	for _, line := range strings.Split(script, "\n") {
+		// The headers are written as "<name>: <value>", e.g. "label: gpt",
+		// the partitions as "<field>=<value>, ..."
+		if strings.Contains(line, "=") && !strings.Contains(line, ":") {
+			run.partitions++
+		}
+	}
+
+	if previous, found := r.partitioned[args[len(args)-1]]; found && run.append {
+		run.deleted = previous.deleted
+	}
+	r.partitioned[args[len(args)-1]] = run
+}
+
+// Remembers the partitions an 'sfdisk --delete <drive> <number>...'
+// command would have deleted, the other partitions being kept.
+func (r *Recorder) recordSfdiskDelete(drive string, numbers []string) {
+	run, found := r.partitioned[drive]
+	if !found {
+		run = sfdiskRun{append: true}
+	}
+	for _, number := range numbers {
+		if n, err := strconv.Atoi(number); err == nil {
+			run.deleted = append(run.deleted, n)
+		}
+	}
+	r.partitioned[drive] = run
+}
+
+// Returns the 'sfdisk --json' output the drive would have
+// after being partitioned by the given sfdisk run. The new
+// partitions take the lowest free numbers, like sfdisk does,
+// the partitions being listed by number.
+func (r *Recorder) simulateSfdiskJson(drive string, run sfdiskRun) (runner.Result, error) {
+	var state sfdiskState
+	if run.append {
+		if err := json.Unmarshal([]byte(r.states[drive]), &state); err != nil {
+			return runner.Result{}, fmt.Errorf("no initial state recorded for drive '%s': error=%s", drive, err.Error())
+		}
+	}
+	state.PartitionTable.Device = drive
+
+	deleted := make(map[string]bool)
+	for _, number := range run.deleted {
+		deleted[partitionNode(drive, number)] = true
+	}
+	partitions := slices.DeleteFunc(state.PartitionTable.Partitions, func(p sfdiskPartition) bool {
+		return deleted[p.Node]
+	})
+	used := make(map[string]bool)
+	for _, p := range partitions {
+		used[p.Node] = true
+	}
+
+	number := 0
+	for range run.partitions {
+		number++
+		for used[partitionNode(drive, number)] {
+			number++
+		}
+		node := partitionNode(drive, number)
+		r.created[node] = true
+		partitions = append(partitions, sfdiskPartition{Node: node})
+	}
+	slices.SortStableFunc(partitions, func(a, b sfdiskPartition) int {
+		return cmp.Compare(nodeNumber(a.Node), nodeNumber(b.Node))
+	})
+	state.PartitionTable.Partitions = partitions
+
+	output, err := json.Marshal(state)
+	return runner.Result{Stdout: string(output)}, err
+}
+
+// Marks the logical volume created by
+// 'lvcreate [options] --name <name> <volume group>' as created,
+// as /dev/<volume group>/<name>.
+func (r *Recorder) recordLvcreate(args []string) {
+	i := slices.Index(args, "--name")
+	if i < 0 || i+1 >= len(args) {
+		return
+	}
+	r.created["/dev/"+args[len(args)-1]+"/"+args[i+1]] = true
+}
+
+// Returns the output of 'blkid --match-tag <tag> --output value <node>'
+// for a partition that would have been created. Since the partition
+// doesn't exist, the value is a placeholder, e.g. "<UUID of /dev/sda1>".
+func simulateBlkid(args []string) runner.Result {
+	tag := "UUID"
+	for i, arg := range args[:len(args)-1] {
+		if arg == "--match-tag" || arg == "-s" {
+			tag = args[i+1]
+		}
+	}
+
+	return runner.Result{Stdout: fmt.Sprintf("<%s of %s>\n", tag, args[len(args)-1])}
+}
+
+// Returns the device node of the partition with the given number,
+// e.g. /dev/sda1 or /dev/nvme0n1p1.
+func partitionNode(drive string, number int) string {
+	last := rune(drive[len(drive)-1])
+	if unicode.IsDigit(last) {
+		return fmt.Sprintf("%sp%d", drive, number)
+	}
+	return fmt.Sprintf("%s%d", drive, number)
+}
+
+// Returns the number of the partition at node, e.g. 1 for
+// /dev/sda1 or /dev/nvme0n1p1, or 0 if it has none.
+func nodeNumber(node string) int {
+	number, _ := strconv.Atoi(node[len(strings.TrimRight(node, "0123456789")):])
+	return number
+}
@@ -0,0 +1,63 @@
+package runner
+
+import "context"
+
+// contextRunner is a Runner giving its context to every
+// command before handing it to the wrapped Runner.
+type contextRunner struct {
+	ctx   context.Context
+	inner Runner
+}
+
+// Returns a Runner wrapping r that stops the running commands
+// and refuses to start new ones once ctx is done.
+func WithContext(ctx context.Context, r Runner) Runner {
+	return &contextRunner{
+		ctx:   ctx,
+		inner: r,
+	}
+}
+
+// Runs the command with the wrapped Runner.
+func (c *contextRunner) Run(cmd Cmd) (Result, error) {
+	if err := c.ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	cmd.Context = c.ctx
+	return c.inner.Run(cmd)
+}
+
+// Runs the read-only command with the wrapped Runner.
+func (c *contextRunner) Query(cmd Cmd) (Result, error) {
+	if err := c.ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	cmd.Context = c.ctx
+	return c.inner.Query(cmd)
+}
+
+// Runs the command inside the chroot with the wrapped Runner.
+func (c *contextRunner) RunInChroot(root string, cmd Cmd) (Result, error) {
+	if err := c.ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	cmd.Context = c.ctx
+	return c.inner.RunInChroot(root, cmd)
+}
+
+// Reads the file with the wrapped Runner.
+func (c *contextRunner) ReadFile(path string) ([]byte, error) {
+	return c.inner.ReadFile(path)
+}
+
+// Writes the file with the wrapped Runner.
+func (c *contextRunner) WriteFile(path string, data []byte) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	return c.inner.WriteFile(path, data)
+}
@@ -0,0 +1,26 @@
+package runner
+
+import "fmt"
+
+// CommandError represents an error that occured during the
+// execution of a command.
+//
+// It wraps the original error along with the exit code and the
+// STDERR output of the command for better debugging.
+type CommandError struct {
+	Command  string
+	ExitCode int
+	StdErr   string
+	Err      error
+}
+
+// Error returns a formatted error message including the command,
+// its exit code, the content of STDERR and the original error message.
+func (e CommandError) Error() string {
+	return fmt.Sprintf("command %q failed: exit code=%d, STDERR=%q, error=%v", e.Command, e.ExitCode, e.StdErr, e.Err)
+}
+
+// Unwrap returns the underlying error for error chaining.
+func (e CommandError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,138 @@
+package runner
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// Fake is a scripted Runner returning canned results, to be used in
+// tests. Nothing is executed: every call is recorded inside Calls.
+//
+// Results are looked up by command line, as returned by Cmd.String.
+// Commands run inside the chroot are looked up with the "chroot: "
+// prefix. Commands without a scripted result succeed with an empty
+// output.
+type Fake struct {
+	// Calls holds every call made, in order, as
+	// "run: <command>", "query: <command>", "chroot: <command>",
+	// "read: <path>" or "write: <path>".
+	Calls []string
+	// Inputs holds what was fed through STDIN for each call
+	// and the data of each written file, at the same index as Calls.
+	Inputs []string
+	// Files holds the content of the files that can be read and
+	// receives the written files.
+	Files map[string][]byte
+
+	results map[string][]Result
+}
+
+// Returns a new Fake without any scripted result.
+func NewFake() *Fake {
+	return &Fake{
+		Files:   make(map[string][]byte),
+		results: make(map[string][]Result),
+	}
+}
+
+// Scripts the result returned the next time the given command line
+// is executed. Results scripted for the same command line are returned
+// in order, the last one being returned for every following call.
+//
+// A non-zero exit code makes the call return a CommandError.
+func (f *Fake) On(commandLine string, result Result) *Fake {
+	f.results[commandLine] = append(f.results[commandLine], result)
+	return f
+}
+
+// Scripts the STDOUT output returned the next time the given command
+// line is executed, see On.
+func (f *Fake) OnOutput(commandLine, stdout string) *Fake {
+	return f.On(commandLine, Result{Stdout: stdout})
+}
+
+// Records the call and returns its scripted result.
+//
+// Can return error types:
+//   - CommandError
+func (f *Fake) Run(cmd Cmd) (Result, error) {
+	return f.execute("run", cmd.String(), cmd)
+}
+
+// Records the call and returns its scripted result.
+//
+// Can return error types:
+//   - CommandError
+func (f *Fake) Query(cmd Cmd) (Result, error) {
+	return f.execute("query", cmd.String(), cmd)
+}
+
+// Records the call and returns the result scripted
+// for "chroot: <command>".
+//
+// Can return error types:
+//   - CommandError
+func (f *Fake) RunInChroot(root string, cmd Cmd) (Result, error) {
+	return f.execute("chroot", "chroot: "+cmd.String(), cmd)
+}
+
+// Records the call and returns the content of Files[path].
+func (f *Fake) ReadFile(path string) ([]byte, error) {
+	f.record("read", path, "")
+
+	data, found := f.Files[path]
+	if !found {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+
+	return data, nil
+}
+
+// Records the call and saves data inside Files[path].
+func (f *Fake) WriteFile(path string, data []byte) error {
+	f.record("write", path, string(data))
+	f.Files[path] = data
+	return nil
+}
+
+// Records the call and returns the next scripted result of key.
+func (f *Fake) execute(kind, key string, cmd Cmd) (Result, error) {
+	f.record(kind, cmd.String(), cmd.Stdin)
+
+	var result Result
+	if scripted := f.results[key]; len(scripted) > 0 {
+		result = scripted[0]
+		if len(scripted) > 1 {
+			f.results[key] = scripted[1:]
+		}
+	}
+
+	if cmd.OnOutput != nil {
+		for _, output := range []string{result.Stdout, result.Stderr} {
+			if output == "" {
+				continue
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+				cmd.OnOutput(line)
+			}
+		}
+	}
+
+	if result.ExitCode != 0 {
+		return result, CommandError{
+			Command:  cmd.String(),
+			ExitCode: result.ExitCode,
+			StdErr:   result.Stderr,
+			Err:      fmt.Errorf("exit status %d", result.ExitCode),
+		}
+	}
+
+	return result, nil
+}
+
+// Adds a call to Calls and Inputs.
+func (f *Fake) record(kind, target, input string) {
+	f.Calls = append(f.Calls, kind+": "+target)
+	f.Inputs = append(f.Inputs, input)
+}
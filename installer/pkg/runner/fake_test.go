@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"testing"
+)
+
+func TestFakeScriptedResults(t *testing.T) {
+	tests := []struct {
+		name      string
+		scripted  []Result
+		calls     int
+		wantCodes []int
+		wantOut   []string
+	}{
+		{
+			name:      "not scripted",
+			calls:     2,
+			wantCodes: []int{0, 0},
+			wantOut:   []string{"", ""},
+		},
+		{
+			name:      "returned in order, the last one repeated",
+			scripted:  []Result{{Stdout: "first"}, {Stdout: "second"}},
+			calls:     3,
+			wantCodes: []int{0, 0, 0},
+			wantOut:   []string{"first", "second", "second"},
+		},
+		{
+			name:      "failing",
+			scripted:  []Result{{ExitCode: 2, Stderr: "no such drive"}, {Stdout: "ok"}},
+			calls:     2,
+			wantCodes: []int{2, 0},
+			wantOut:   []string{"", "ok"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := NewFake()
+			for _, result := range test.scripted {
+				f.On("lsblk /dev/sda -dno pttype", result)
+			}
+
+			for i := range test.calls {
+				result, err := f.Query(Command("lsblk", "/dev/sda", "-dno", "pttype"))
+
+				var commandErr CommandError
+				if test.wantCodes[i] != 0 {
+					if !errors.As(err, &commandErr) || commandErr.ExitCode != test.wantCodes[i] {
+						t.Errorf("call %d: error = %v, want a CommandError with exit code %d", i, err, test.wantCodes[i])
+					}
+				} else if err != nil {
+					t.Errorf("call %d: error = %v, want nil", i, err)
+				}
+				if result.Stdout != test.wantOut[i] {
+					t.Errorf("call %d: stdout = %q, want %q", i, result.Stdout, test.wantOut[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFakeRecordsCalls(t *testing.T) {
+	f := NewFake()
+	f.OnOutput("chroot: /bin/bash -c locale-gen", "Generating locales...\n")
+	f.Files["/etc/locale.gen"] = []byte("#en_US.UTF-8 UTF-8\n")
+
+	cmd := Command("sfdisk", "/dev/sda")
+	cmd.Stdin = "type=L\n"
+	if _, err := f.Run(cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	chrootCmd := Command("/bin/bash", "-c", "locale-gen")
+	chrootCmd.OnOutput = func(line string) { lines = append(lines, line) }
+	if _, err := f.RunInChroot("/mnt", chrootCmd); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Generating locales..."}; !slices.Equal(lines, want) {
+		t.Errorf("output lines = %q, want %q", lines, want)
+	}
+
+	if data, err := f.ReadFile("/etc/locale.gen"); err != nil || string(data) != "#en_US.UTF-8 UTF-8\n" {
+		t.Errorf("ReadFile() = %q, %v", data, err)
+	}
+	if _, err := f.ReadFile("/etc/hostname"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile() of a missing file error = %v, want %v", err, fs.ErrNotExist)
+	}
+	if err := f.WriteFile("/etc/hostname", []byte("october\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(f.Files["/etc/hostname"]); got != "october\n" {
+		t.Errorf("written file = %q, want %q", got, "october\n")
+	}
+
+	wantCalls := []string{
+		"run: sfdisk /dev/sda",
+		"chroot: /bin/bash -c locale-gen",
+		"read: /etc/locale.gen",
+		"read: /etc/hostname",
+		"write: /etc/hostname",
+	}
+	if !slices.Equal(f.Calls, wantCalls) {
+		t.Errorf("calls = %q, want %q", f.Calls, wantCalls)
+	}
+	wantInputs := []string{"type=L\n", "", "", "", "october\n"}
+	if !slices.Equal(f.Inputs, wantInputs) {
+		t.Errorf("inputs = %q, want %q", f.Inputs, wantInputs)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"mkfs.ext4", "/dev/sda2"}, want: "mkfs.ext4 /dev/sda2"},
+		{args: []string{"bash", "-c", "echo hi"}, want: "bash -c 'echo hi'"},
+		{args: []string{"echo", ""}, want: "echo ''"},
+		{args: []string{"echo", "it's"}, want: `echo 'it'\''s'`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if got := Quote(test.args); got != test.want {
+				t.Errorf("Quote(%q) = %q, want %q", test.args, got, test.want)
+			}
+		})
+	}
+}
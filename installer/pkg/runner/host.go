@@ -0,0 +1,131 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Host executes everything for real on the live system.
+type Host struct{}
+
+// Executes the command.
+//
+// Can return error types:
+//   - CommandError
+func (h Host) Run(cmd Cmd) (Result, error) {
+	var execCmd *exec.Cmd
+	if cmd.Context != nil {
+		execCmd = exec.CommandContext(cmd.Context, cmd.Name, cmd.Args...)
+	} else {
+		execCmd = exec.Command(cmd.Name, cmd.Args...)
+	}
+	if cmd.Stdin != "" {
+		execCmd.Stdin = strings.NewReader(cmd.Stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	var lines *lineWriter
+	if cmd.OnOutput != nil {
+		lines = &lineWriter{onLine: cmd.OnOutput}
+		execCmd.Stdout = io.MultiWriter(&stdout, lines)
+		execCmd.Stderr = io.MultiWriter(&stderr, lines)
+	} else {
+		execCmd.Stdout = &stdout
+		execCmd.Stderr = &stderr
+	}
+
+	err := execCmd.Run()
+	if lines != nil {
+		lines.flush()
+	}
+
+	result := Result{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: execCmd.ProcessState.ExitCode(), // -1 if it couldn't start
+	}
+
+	if err != nil {
+		return result, CommandError{
+			Command:  cmd.String(),
+			ExitCode: result.ExitCode,
+			StdErr:   result.Stderr,
+			Err:      err,
+		}
+	}
+
+	return result, nil
+}
+
+// Executes the read-only command, same as Run.
+//
+// Can return error types:
+//   - CommandError
+func (h Host) Query(cmd Cmd) (Result, error) {
+	return h.Run(cmd)
+}
+
+// Executes the command inside the system mounted at root.
+//
+// It executes: arch-chroot [root] [name] [args...]
+//
+// Can return error types:
+//   - CommandError
+func (h Host) RunInChroot(root string, cmd Cmd) (Result, error) {
+	chrootCmd := cmd
+	chrootCmd.Name = "arch-chroot"
+	chrootCmd.Args = append([]string{root, cmd.Name}, cmd.Args...)
+	return h.Run(chrootCmd)
+}
+
+// Returns the content of the file at path.
+func (h Host) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// Writes data inside the file at path.
+func (h Host) WriteFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0644)
+}
+
+// lineWriter is an io.Writer calling onLine for each
+// complete line written to it.
+type lineWriter struct {
+	mu      sync.Mutex
+	pending []byte
+	onLine  func(line string)
+}
+
+// Calls onLine for every complete line and keeps the
+// rest until the next write.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		w.onLine(strings.TrimSuffix(string(w.pending[:i]), "\r"))
+		w.pending = w.pending[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Calls onLine with what is left after the last newline.
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending) > 0 {
+		w.onLine(string(w.pending))
+		w.pending = nil
+	}
+}
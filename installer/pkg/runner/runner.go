@@ -0,0 +1,94 @@
+// Package runner provides the Runner interface used by every package
+// to execute commands and to read and write files, so that the
+// packages never touch the machine directly.
+//
+// Host executes everything for real on the live system, Fake returns
+// canned results and can be used to test the packages without root
+// or real drives.
+package runner
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// Runner executes the commands and file accesses of the installation.
+//
+// The returned Result is always filled with what the command produced,
+// even when an error is returned.
+type Runner interface {
+	// Run executes a command changing the state of the live system.
+	Run(cmd Cmd) (Result, error)
+	// Query executes a read-only command on the live system.
+	Query(cmd Cmd) (Result, error)
+	// RunInChroot executes a command inside the system mounted at root
+	// using arch-chroot.
+	RunInChroot(root string, cmd Cmd) (Result, error)
+	// ReadFile returns the content of the file at path.
+	ReadFile(path string) ([]byte, error)
+	// WriteFile creates or truncates the file at path and writes data inside.
+	WriteFile(path string, data []byte) error
+}
+
+// Cmd represents a command to execute.
+type Cmd struct {
+	Name string
+	Args []string
+	// Stdin is fed to the command through STDIN when not empty.
+	Stdin string
+	// Secret is true when Stdin holds a secret, e.g. a password or a
+	// passphrase, that must never be shown or recorded.
+	Secret bool
+	// OnOutput, when not nil, is called with every line written by the
+	// command on STDOUT or STDERR as soon as it is written.
+	OnOutput func(line string)
+	// Context, when not nil, stops the command when it is done.
+	Context context.Context
+}
+
+// Returns a new Cmd with the given name and arguments.
+func Command(name string, args ...string) Cmd {
+	return Cmd{
+		Name: name,
+		Args: args,
+	}
+}
+
+// Returns a new Cmd executing the given command line with bash.
+func Shell(command string) Cmd {
+	return Command("/bin/bash", "-c", command)
+}
+
+// Returns the command line of the command, quoted so that it can
+// be pasted inside a shell.
+func (c Cmd) String() string {
+	return Quote(append([]string{c.Name}, c.Args...))
+}
+
+// Result represents what a command produced.
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Returns the arguments joined as a command line that can be
+// pasted inside a shell.
+func Quote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.IndexFunc(arg, unsafeShellRune) == -1 {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// Returns true if the rune needs to be quoted inside a shell.
+func unsafeShellRune(r rune) bool {
+	return !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_./=:,+@%", r))
+}
@@ -0,0 +1,21 @@
+package server
+
+import "fmt"
+
+// ServerError represents an error that occured while
+// listening or serving the API.
+type ServerError struct {
+	Err error
+}
+
+// Error returns a formatted error message containing the
+// original error message inside.
+func (e ServerError) Error() string {
+	return fmt.Sprintf("Server error: error=%s", e.Err.Error())
+}
+
+// Unwrap returns the original error wrapped inside
+// ServerError.
+func (e ServerError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/october-os/october-installer/pkg/events"
+)
+
+// hub is an events.Emitter keeping every event of one installation
+// and forwarding them to its subscribers.
+type hub struct {
+	mu          sync.Mutex
+	history     []events.Event
+	subscribers map[chan events.Event]struct{}
+	// done is closed once the installation is over
+	done chan struct{}
+}
+
+// Returns a new empty hub.
+func newHub() *hub {
+	return &hub{
+		subscribers: make(map[chan events.Event]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Keeps the event and sends it to every subscriber. A subscriber
+// whose buffer is full is unsubscribed and its channel closed, so
+// it can subscribe again and get the events it missed from the
+// history instead of silently missing them.
+func (h *hub) Emit(e events.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.history = append(h.history, e)
+	for subscriber := range h.subscribers {
+		select {
+		case subscriber <- e:
+		default:
+			delete(h.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// Returns every event emitted so far and a channel receiving the
+// next ones. The channel is closed once the installation is over,
+// or when the subscriber was too slow to receive the events, see
+// over. Call unsubscribe when the events aren't needed anymore.
+func (h *hub) subscribe() (history []events.Event, next <-chan events.Event, unsubscribe func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	history = append([]events.Event(nil), h.history...)
+	subscriber := make(chan events.Event, 256)
+	if h.over() {
+		close(subscriber)
+		return history, subscriber, func() {}
+	}
+
+	h.subscribers[subscriber] = struct{}{}
+	return history, subscriber, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if _, found := h.subscribers[subscriber]; found {
+			delete(h.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// Returns true once the installation is over and every event
+// was emitted.
+func (h *hub) over() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Closes every subscriber channel, no event can be emitted anymore.
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	close(h.done)
+	for subscriber := range h.subscribers {
+		delete(h.subscribers, subscriber)
+		close(subscriber)
+	}
+}
@@ -0,0 +1,522 @@
+// Package server provides the HTTP API used by web and desktop
+// frontends to drive an installation without the CLI.
+//
+// Endpoints:
+//
+//	GET  /catalog         returns the values a payload can be built from
+//	POST /validate        validates the payload in the body and returns the report
+//	PUT  /payload         validates and keeps the payload in the body for the next install
+//	GET  /plan            returns the plan of the kept payload
+//	POST /install         starts installing the kept payload
+//	POST /install/cancel  cancels the running installation
+//	GET  /events          streams the events of the installation with Server-Sent Events
+//	GET  /report          returns the report of the last installation
+//
+// Errors are returned as {"error": "<message>"}.
+//
+// Since the API isn't authenticated, requests sent to a loopback
+// address with another Host than a loopback one (DNS rebinding) and
+// requests sent by a web page that isn't served from a loopback
+// address (cross-site request forgery) are refused with status 403.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/october-os/october-installer/pkg/catalog"
+	"github.com/october-os/october-installer/pkg/events"
+	"github.com/october-os/october-installer/pkg/installer"
+	"github.com/october-os/october-installer/pkg/payload"
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+// States of an installation inside a Report.
+const (
+	StateIdle      string = "idle"
+	StateRunning   string = "running"
+	StateSucceeded string = "succeeded"
+	StateFailed    string = "failed"
+	StateCancelled string = "cancelled"
+)
+
+// maxPayloadSize is the maximum size of a payload in bytes.
+const maxPayloadSize int64 = 1 << 20
+
+// Report represents the state and outcome of the last installation.
+type Report struct {
+	State          string     `json:"state"`
+	CompletedSteps []string   `json:"completedSteps"`
+	FailedStep     string     `json:"failedStep,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	StartedAt      *time.Time `json:"startedAt,omitempty"`
+	FinishedAt     *time.Time `json:"finishedAt,omitempty"`
+}
+
+// InstallRequest represents the body of POST /install.
+// The body is optional.
+type InstallRequest struct {
+	Resume                 bool `json:"resume"`
+	RestorePartitionTables bool `json:"restorePartitionTables"`
+}
+
+// Server serves the installer API.
+type Server struct {
+	runner  runner.Runner
+	options installer.Options
+
+	mu      sync.Mutex
+	payload *payload.Payload
+	hub     *hub
+	cancel  context.CancelFunc
+	report  Report
+}
+
+// Returns a new Server running the installations with r. The journal
+// and rollback options are used for every installation.
+func New(r runner.Runner, options installer.Options) *Server {
+	return &Server{
+		runner:  r,
+		options: options,
+		report: Report{
+			State:          StateIdle,
+			CompletedSteps: []string{},
+		},
+	}
+}
+
+// Returns the handler of every endpoint, refusing the requests
+// that don't come from the machine itself, see checkOrigin.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /catalog", s.handleCatalog)
+	mux.HandleFunc("POST /validate", s.handleValidate)
+	mux.HandleFunc("PUT /payload", s.handlePayload)
+	mux.HandleFunc("GET /plan", s.handlePlan)
+	mux.HandleFunc("POST /install", s.handleInstall)
+	mux.HandleFunc("POST /install/cancel", s.handleCancel)
+	mux.HandleFunc("GET /events", s.handleEvents)
+	mux.HandleFunc("GET /report", s.handleReport)
+	return checkOrigin(mux)
+}
+
+// Wraps the handler to refuse, with status 403, the requests whose
+// Host isn't a loopback host when received on a TCP address, and
+// the requests whose Origin isn't a loopback origin. Requests sent
+// by other programs than web browsers don't have any Origin.
+func checkOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Web pages can't reach a Unix socket, its Host is meaningless
+		local, _ := req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+		if (local == nil || local.Network() != "unix") && !isLoopbackHost(req.Host) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("host '%s' isn't a loopback host", req.Host))
+			return
+		}
+
+		if origin := req.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !isLoopbackHost(u.Host) {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("origin '%s' isn't a loopback origin", origin))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Returns true if the host, with or without a port, is "localhost"
+// or a loopback IP address.
+func isLoopbackHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]")
+	}
+
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Listens on the given address and serves the API until ctx is done.
+// The running installation is cancelled when ctx is done.
+//
+// The address is either "unix:<path>" for a Unix socket or
+// "<host>:<port>" with a loopback host, e.g. "localhost:8080".
+//
+// Can return error types:
+//   - ServerError
+func (s *Server) ListenAndServe(ctx context.Context, address string) error {
+	listener, err := listen(address)
+	if err != nil {
+		return ServerError{Err: err}
+	}
+
+	httpServer := &http.Server{Handler: s.Handler()}
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		if s.cancel != nil {
+			s.cancel()
+		}
+		s.mu.Unlock()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return ServerError{Err: err}
+	}
+
+	s.wait()
+	return nil
+}
+
+// Creates the listener for the address. Only Unix sockets and
+// loopback addresses are allowed since the API isn't authenticated.
+func listen(address string) (net.Listener, error) {
+	if path, found := strings.CutPrefix(address, "unix:"); found {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			listener.Close()
+			return nil, err
+		}
+		return listener, nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return nil, fmt.Errorf("address '%s' isn't a loopback address", address)
+		}
+	}
+
+	return net.Listen("tcp", address)
+}
+
+// Waits for the running installation to be over.
+func (s *Server) wait() {
+	s.mu.Lock()
+	h := s.hub
+	s.mu.Unlock()
+
+	if h == nil {
+		return
+	}
+
+	<-h.done
+}
+
+// Returns the catalog.
+func (s *Server) handleCatalog(w http.ResponseWriter, req *http.Request) {
+	c, err := catalog.Load(s.runner)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusOK, c)
+}
+
+// Validates the payload of the body and returns the report,
+// with status 422 if it is invalid.
+func (s *Server) handleValidate(w http.ResponseWriter, req *http.Request) {
+	p, report := s.readPayload(req)
+	if p != nil {
+		report = p.Check(s.runner)
+	}
+
+	writeReport(w, report)
+}
+
+// Validates the payload of the body and keeps it if it is valid.
+// Returns the report, with status 422 if it is invalid.
+func (s *Server) handlePayload(w http.ResponseWriter, req *http.Request) {
+	p, report := s.readPayload(req)
+	if p != nil {
+		report = p.Check(s.runner)
+	}
+
+	if report.Valid() {
+		s.mu.Lock()
+		if s.report.State == StateRunning {
+			s.mu.Unlock()
+			writeError(w, http.StatusConflict, "an installation is running")
+			return
+		}
+		s.payload = p
+		s.mu.Unlock()
+	}
+
+	writeReport(w, report)
+}
+
+// Returns the plan of the kept payload.
+func (s *Server) handlePlan(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	p := s.payload
+	s.mu.Unlock()
+
+	if p == nil {
+		writeError(w, http.StatusConflict, "no payload was submitted")
+		return
+	}
+
+	installPlan, err := installer.Plan(s.runner, p)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJson(w, http.StatusOK, installPlan)
+}
+
+// Starts installing the kept payload in the background.
+func (s *Server) handleInstall(w http.ResponseWriter, req *http.Request) {
+	var request InstallRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxPayloadSize)).Decode(&request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.payload == nil {
+		writeError(w, http.StatusConflict, "no payload was submitted")
+		return
+	}
+	if s.report.State == StateRunning {
+		writeError(w, http.StatusConflict, "an installation is already running")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := newHub()
+	startedAt := time.Now()
+	s.cancel = cancel
+	s.hub = h
+	s.report = Report{
+		State:          StateRunning,
+		CompletedSteps: []string{},
+		StartedAt:      &startedAt,
+	}
+
+	options := s.options
+	options.Resume = request.Resume
+	options.RestorePartitionTables = request.RestorePartitionTables
+	options.Events = &reportEmitter{server: s, next: h}
+
+	go s.install(ctx, cancel, s.payload, options, h)
+
+	writeJson(w, http.StatusAccepted, s.report)
+}
+
+// Runs the installation and keeps its outcome inside the report.
+func (s *Server) install(ctx context.Context, cancel context.CancelFunc, p *payload.Payload, options installer.Options, h *hub) {
+	defer cancel()
+
+	err := installer.Install(ctx, s.runner, p, options)
+
+	s.mu.Lock()
+	finishedAt := time.Now()
+	s.report.FinishedAt = &finishedAt
+	switch {
+	case err == nil:
+		s.report.State = StateSucceeded
+	case ctx.Err() != nil:
+		s.report.State = StateCancelled
+		s.report.Error = err.Error()
+	default:
+		s.report.State = StateFailed
+		s.report.Error = err.Error()
+	}
+	s.cancel = nil
+	s.mu.Unlock()
+
+	h.close()
+}
+
+// Cancels the running installation.
+func (s *Server) handleCancel(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel == nil {
+		writeError(w, http.StatusConflict, "no installation is running")
+		return
+	}
+
+	s.cancel()
+	writeJson(w, http.StatusAccepted, s.report)
+}
+
+// Streams every event of the last installation with Server-Sent
+// Events, starting from the first one. The stream ends with the
+// installation. When the client is too slow and misses events,
+// they are sent again from the history of the hub.
+func (s *Server) handleEvents(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	h := s.hub
+	s.mu.Unlock()
+
+	if h == nil {
+		writeError(w, http.StatusConflict, "no installation was started")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming isn't supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// Number of events already sent to the client
+	sent := 0
+	for {
+		if !streamEvents(w, flusher, req.Context(), h, &sent) {
+			return
+		}
+	}
+}
+
+// Subscribes to the hub, sends the events the client doesn't have
+// yet, then the next ones, sent being the number of events the
+// client already has.
+//
+// Returns true when the client needs to subscribe again, e.g. when
+// it was unsubscribed for being too slow.
+func streamEvents(w http.ResponseWriter, flusher http.Flusher, ctx context.Context, h *hub, sent *int) bool {
+	// The history is complete once the installation is over
+	over := h.over()
+	history, next, unsubscribe := h.subscribe()
+	defer unsubscribe()
+
+	for _, e := range history[*sent:] {
+		writeEvent(w, e)
+	}
+	*sent = len(history)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case e, open := <-next:
+			if !open {
+				return !over
+			}
+			writeEvent(w, e)
+			*sent++
+			flusher.Flush()
+		}
+	}
+}
+
+// Returns the report of the last installation.
+func (s *Server) handleReport(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJson(w, http.StatusOK, s.report)
+}
+
+// Decodes the payload of the body. When it can't be decoded, the
+// returned report holds the problem instead.
+func (s *Server) readPayload(req *http.Request) (*payload.Payload, *validation.Report) {
+	p, err := payload.Decode(http.MaxBytesReader(nil, req.Body, maxPayloadSize))
+	if err != nil {
+		report := &validation.Report{}
+		report.Add("", validation.CodeInvalidFormat, err.Error())
+		return nil, report
+	}
+
+	return p, &validation.Report{}
+}
+
+// reportEmitter keeps the report up to date with the events
+// before handing them to the next Emitter.
+type reportEmitter struct {
+	server *Server
+	next   events.Emitter
+}
+
+// Updates the report with the event and emits it.
+func (r *reportEmitter) Emit(e events.Event) {
+	r.server.mu.Lock()
+	switch e.Type {
+	case events.TypeStepFinished:
+		if e.Step != installer.StepRollback {
+			r.server.report.CompletedSteps = append(r.server.report.CompletedSteps, e.Step)
+		}
+	case events.TypeInstallFailed:
+		r.server.report.FailedStep = e.Step
+	}
+	r.server.mu.Unlock()
+
+	r.next.Emit(e)
+}
+
+// Writes the event in the Server-Sent Events format.
+func writeEvent(w http.ResponseWriter, e events.Event) {
+	data, _ := json.Marshal(e)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+}
+
+// Writes the validation report, with status 422 if it is invalid.
+func writeReport(w http.ResponseWriter, report *validation.Report) {
+	if report.Problems == nil {
+		report.Problems = []validation.Problem{}
+	}
+
+	status := http.StatusOK
+	if !report.Valid() {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJson(w, status, report)
+}
+
+// Writes an error message.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJson(w, status, map[string]string{"error": message})
+}
+
+// Writes the value as JSON with the given status.
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -1,6 +1,13 @@
 package timezone
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTimezone is wrapped inside TimezoneError when
+// the given timezone doesn't exist.
+var ErrInvalidTimezone = errors.New("Invalid timezone")
 
 // TimezoneError represents an error that occured
 // when setting up the new install timezones.
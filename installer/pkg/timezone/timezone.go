@@ -1,24 +1,21 @@
 package timezone
 
 import (
-	"errors"
 	"fmt"
-	"io"
-	"os/exec"
 	"slices"
 	"strings"
 
 	"github.com/october-os/october-installer/pkg/arch_chroot"
+	"github.com/october-os/october-installer/pkg/runner"
 )
 
 // Sets timezone up inside the new install.
 //
 // Can return error types:
-//   - PipeError
 //   - ArchChrootError
-func SetTime(timezone string) error {
+func SetTime(r runner.Runner, timezone string) error {
 	command := fmt.Sprintf("ln -sf /usr/share/zoneinfo/%s /etc/localtime", timezone)
-	return arch_chroot.Run(command)
+	return arch_chroot.Run(r, command)
 }
 
 // Sets up hardware clock to generate /etc/adjtime.
@@ -28,19 +25,18 @@ func SetTime(timezone string) error {
 //	hwclock --systohc
 //
 // Can return error types:
-//   - PipeError
 //   - ArchChrootError
-func SetHwClock() error {
+func SetHwClock(r runner.Runner) error {
 	command := "hwclock --systohc"
-	return arch_chroot.Run(command)
+	return arch_chroot.Run(r, command)
 }
 
 // Checks if the given timezone is a valid.
 //
 // Can return error types:
 //   - TimezoneError
-func ValidateTimezone(timezone string) error {
-	timezones, err := getAllTimezones()
+func ValidateTimezone(r runner.Runner, timezone string) error {
+	timezones, err := getAllTimezones(r)
 	if err != nil {
 		return TimezoneError{
 			Err: err,
@@ -49,38 +45,41 @@ func ValidateTimezone(timezone string) error {
 
 	if _, found := slices.BinarySearch(timezones, timezone); !found {
 		return TimezoneError{
-			Err: errors.New("Invalid timezone"),
+			Err: ErrInvalidTimezone,
 		}
 	}
 
 	return nil
 }
 
+// Returns every available timezone, sorted.
+//
+// Can return error types:
+//   - TimezoneError
+func ListTimezones(r runner.Runner) ([]string, error) {
+	timezones, err := getAllTimezones(r)
+	if err != nil {
+		return nil, TimezoneError{
+			Err: err,
+		}
+	}
+
+	return slices.DeleteFunc(timezones, func(timezone string) bool {
+		return timezone == ""
+	}), nil
+}
+
 // Gets all the timezones from STDOUT and returns them
 // in an array of string.
 //
 // It executes:
 //
 //	timedatectl list-timezones
-func getAllTimezones() ([]string, error) {
-	cmd := exec.Command("timedatectl", "list-timezones")
-	stdout, err := cmd.StdoutPipe()
+func getAllTimezones(r runner.Runner) ([]string, error) {
+	result, err := r.Query(runner.Command("timedatectl", "list-timezones"))
 	if err != nil {
 		return nil, err
 	}
 
-	if err := cmd.Start(); err != nil {
-		return nil, err
-	}
-
-	stdoutBytes, err := io.ReadAll(stdout)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := cmd.Wait(); err != nil {
-		return nil, err
-	}
-
-	return strings.Split(string(stdoutBytes), "\n"), nil
+	return strings.Split(result.Stdout, "\n"), nil
 }
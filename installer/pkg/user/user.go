@@ -4,13 +4,25 @@
 package user
 
 import (
-	"errors"
 	"fmt"
+	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/october-os/october-installer/pkg/arch_chroot"
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/validation"
 )
 
+// usernameRegexp matches the usernames useradd accepts by default:
+// a lowercase letter or an underscore, followed by at most 31
+// lowercase letters, digits, underscores or dashes.
+var usernameRegexp *regexp.Regexp = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// homepathRegexp matches an absolute path made of letters, digits,
+// dots, underscores and dashes.
+var homepathRegexp *regexp.Regexp = regexp.MustCompile(`^(/[A-Za-z0-9._-]+)+$`)
+
 // User represents a user that needs to be created.
 type User struct {
 	Username string `json:"username"`
@@ -21,28 +33,45 @@ type User struct {
 
 // Validates if the user is a valid one or if it contains values that
 // aren't valid.
+//
+// Errors that can be returned:
+//   - NewUserError wrapping a validation.Report
 func (u *User) Validate() error {
-	if strings.TrimSpace(u.Username) == "" || strings.TrimSpace(u.Password) == "" {
+	var report validation.Report
+	u.Check("", &report)
+	if !report.Valid() {
 		return NewUserError{
-			err: errors.New("Can't create user with empty username or password"),
+			err: report.Err(),
 		}
 	}
 
+	return nil
+}
+
+// Checks every value of the user and adds the problems found to
+// the report, path being the JSON path of the user.
+//
+// The default home path is set if none is given.
+func (u *User) Check(path string, report *validation.Report) {
+	if strings.TrimSpace(u.Username) == "" {
+		report.Add(validation.Field(path, "username"), validation.CodeRequired, "Can't create user with empty username")
+	} else if !usernameRegexp.MatchString(u.Username) {
+		report.Add(validation.Field(path, "username"), validation.CodeInvalidFormat, "Username is in the wrong format: it must start with a lowercase letter or '_', followed by at most 31 lowercase letters, digits, '_' or '-'")
+	}
+	if strings.TrimSpace(u.Password) == "" {
+		report.Add(validation.Field(path, "password"), validation.CodeRequired, "Can't create user with empty password")
+	}
+
 	if strings.TrimSpace(u.Homepath) == "" {
 		u.Homepath = fmt.Sprintf("/home/%s", u.Username)
-	} else if strings.HasPrefix(u.Homepath, "/") {
-		return NewUserError{
-			err: errors.New("Provide a valid directory for user home path"),
-		}
+	} else if !homepathRegexp.MatchString(u.Homepath) || filepath.Clean(u.Homepath) != u.Homepath {
+		report.Add(validation.Field(path, "homepath"), validation.CodeInvalidFormat, "Provide a valid directory for user home path: an absolute path made of letters, digits, '.', '_' or '-', without '.' or '..' directories")
 	}
-
-	return nil
 }
 
 // Sets the given password for the root user.
-func SetRootPassword(password string) error {
-	command := fmt.Sprintf("echo %s | passwd -s", password)
-	if err := arch_chroot.Run(command); err != nil {
+func SetRootPassword(r runner.Runner, password string) error {
+	if err := arch_chroot.ExecWithSecret(r, password+"\n", "passwd", "-s"); err != nil {
 		return err
 	}
 
@@ -52,21 +81,20 @@ func SetRootPassword(password string) error {
 // Takes in a user then creates it in the newly installed system.
 //
 // Errors that can be returned:
-//   - PipeError
 //   - ArchChrootError
-func CreateUser(user *User) error {
-	err := userAdd(user.Username, user.Homepath)
+func CreateUser(r runner.Runner, user *User) error {
+	err := userAdd(r, user.Username, user.Homepath)
 	if err != nil {
 		return err
 	}
 
-	err = setPassword(user.Username, user.Password)
+	err = setPassword(r, user.Username, user.Password)
 	if err != nil {
 		return err
 	}
 
 	if user.Sudoer {
-		err = addToSudoer(user.Username)
+		err = addToSudoer(r, user.Username)
 		if err != nil {
 			return err
 		}
@@ -79,13 +107,12 @@ func CreateUser(user *User) error {
 // inside the newly installed system.
 //
 // Errors that can be returned:
-//   - PipeError
 //   - ArchChrootError
-func SetupSudoerFile() error {
+func SetupSudoerFile(r runner.Runner) error {
 	wheelLine := "%wheel      ALL=(ALL:ALL) ALL"
 	command := fmt.Sprintf("echo \"%s\" >> /etc/sudoers", wheelLine)
 
-	err := arch_chroot.Run(command)
+	err := arch_chroot.Run(r, command)
 	if err != nil {
 		return err
 	}
@@ -98,12 +125,9 @@ func SetupSudoerFile() error {
 // SetupSudoerFile() before running this.
 //
 // Errors that can be returned:
-//   - PipeError
 //   - ArchChrootError
-func addToSudoer(username string) error {
-	addToWheel := fmt.Sprintf("usermod -aG wheel %s", username)
-
-	err := arch_chroot.Run(addToWheel)
+func addToSudoer(r runner.Runner, username string) error {
+	err := arch_chroot.Exec(r, "usermod", "-aG", "wheel", username)
 	if err != nil {
 		return err
 	}
@@ -115,12 +139,9 @@ func addToSudoer(username string) error {
 // installed system.
 //
 // Errors that can be returned:
-//   - PipeError
 //   - ArchChrootError
-func userAdd(username, homepath string) error {
-	createCommand := fmt.Sprintf("useradd -m %s -d %s", username, homepath)
-
-	err := arch_chroot.Run(createCommand)
+func userAdd(r runner.Runner, username, homepath string) error {
+	err := arch_chroot.Exec(r, "useradd", "-m", "-d", homepath, username)
 	if err != nil {
 		return err
 	}
@@ -132,12 +153,9 @@ func userAdd(username, homepath string) error {
 // the newly installed system.
 //
 // Errors that can be returned:
-//   - PipeError
 //   - ArchChrootError
-func setPassword(username, password string) error {
-	command := fmt.Sprintf("echo %s | passwd %s -s", password, username)
-
-	err := arch_chroot.Run(command)
+func setPassword(r runner.Runner, username, password string) error {
+	err := arch_chroot.ExecWithSecret(r, password+"\n", "passwd", "-s", username)
 	if err != nil {
 		return err
 	}
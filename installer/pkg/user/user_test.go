@@ -0,0 +1,168 @@
+package user
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/october-os/october-installer/pkg/arch_chroot"
+	"github.com/october-os/october-installer/pkg/runner"
+	"github.com/october-os/october-installer/pkg/validation"
+)
+
+func TestCreateUser(t *testing.T) {
+	tests := []struct {
+		name string
+		user User
+		// failing is the command scripted to fail, if any
+		failing    string
+		wantCalls  []string
+		wantInputs []string
+		wantErr    bool
+	}{
+		{
+			name: "user",
+			user: User{Username: "alice", Password: "secret", Homepath: "/home/alice"},
+			wantCalls: []string{
+				"chroot: useradd -m -d /home/alice alice",
+				"chroot: passwd -s alice",
+			},
+			wantInputs: []string{"", "secret\n"},
+		},
+		{
+			name: "sudoer",
+			user: User{Username: "bob", Password: "hunter2", Homepath: "/srv/bob", Sudoer: true},
+			wantCalls: []string{
+				"chroot: useradd -m -d /srv/bob bob",
+				"chroot: passwd -s bob",
+				"chroot: usermod -aG wheel bob",
+			},
+			wantInputs: []string{"", "hunter2\n", ""},
+		},
+		{
+			name:    "useradd failing",
+			user:    User{Username: "alice", Password: "secret", Homepath: "/home/alice", Sudoer: true},
+			failing: "chroot: useradd -m -d /home/alice alice",
+			wantCalls: []string{
+				"chroot: useradd -m -d /home/alice alice",
+			},
+			wantInputs: []string{""},
+			wantErr:    true,
+		},
+		{
+			name:    "passwd failing",
+			user:    User{Username: "alice", Password: "secret", Homepath: "/home/alice", Sudoer: true},
+			failing: "chroot: passwd -s alice",
+			wantCalls: []string{
+				"chroot: useradd -m -d /home/alice alice",
+				"chroot: passwd -s alice",
+			},
+			wantInputs: []string{"", "secret\n"},
+			wantErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := runner.NewFake()
+			if test.failing != "" {
+				f.On(test.failing, runner.Result{ExitCode: 1, Stderr: "failed"})
+			}
+
+			err := CreateUser(f, &test.user)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("CreateUser() error = %v, want error %t", err, test.wantErr)
+			}
+			if test.wantErr && !errors.As(err, &arch_chroot.ArchChrootError{}) {
+				t.Errorf("CreateUser() error = %T, want arch_chroot.ArchChrootError", err)
+			}
+			if !slices.Equal(f.Calls, test.wantCalls) {
+				t.Errorf("calls = %q, want %q", f.Calls, test.wantCalls)
+			}
+			if !slices.Equal(f.Inputs, test.wantInputs) {
+				t.Errorf("inputs = %q, want %q", f.Inputs, test.wantInputs)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		user         User
+		wantPaths    []string
+		wantHomepath string
+	}{
+		{
+			name:         "default home path",
+			user:         User{Username: "alice", Password: "secret"},
+			wantHomepath: "/home/alice",
+		},
+		{
+			name:         "given home path",
+			user:         User{Username: "alice", Password: "secret", Homepath: "/srv/alice"},
+			wantHomepath: "/srv/alice",
+		},
+		{
+			name:         "missing username and password",
+			user:         User{Username: " ", Homepath: "/home/nobody"},
+			wantPaths:    []string{"users[0].username", "users[0].password"},
+			wantHomepath: "/home/nobody",
+		},
+		{
+			name:         "relative home path",
+			user:         User{Username: "alice", Password: "secret", Homepath: "alice"},
+			wantPaths:    []string{"users[0].homepath"},
+			wantHomepath: "alice",
+		},
+		{
+			name:         "uppercase username",
+			user:         User{Username: "Alice", Password: "secret"},
+			wantPaths:    []string{"users[0].username"},
+			wantHomepath: "/home/Alice",
+		},
+		{
+			name:         "username with a shell command",
+			user:         User{Username: "alice;reboot", Password: "secret", Homepath: "/home/alice"},
+			wantPaths:    []string{"users[0].username"},
+			wantHomepath: "/home/alice",
+		},
+		{
+			name:         "username too long",
+			user:         User{Username: "a" + strings.Repeat("b", 32), Password: "secret", Homepath: "/home/alice"},
+			wantPaths:    []string{"users[0].username"},
+			wantHomepath: "/home/alice",
+		},
+		{
+			name:         "home path with a space",
+			user:         User{Username: "alice", Password: "secret", Homepath: "/home/alice smith"},
+			wantPaths:    []string{"users[0].homepath"},
+			wantHomepath: "/home/alice smith",
+		},
+		{
+			name:         "home path with a parent directory",
+			user:         User{Username: "alice", Password: "secret", Homepath: "/home/../etc"},
+			wantPaths:    []string{"users[0].homepath"},
+			wantHomepath: "/home/../etc",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var report validation.Report
+			test.user.Check("users[0]", &report)
+
+			var paths []string
+			for _, problem := range report.Problems {
+				paths = append(paths, problem.Path)
+			}
+			if !slices.Equal(paths, test.wantPaths) {
+				t.Errorf("problems = %q, want %q", paths, test.wantPaths)
+			}
+			if test.user.Homepath != test.wantHomepath {
+				t.Errorf("homepath = %q, want %q", test.user.Homepath, test.wantHomepath)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Package validation provides the report used to collect every
+// problem found while validating a payload, instead of stopping
+// at the first one.
+//
+// Each problem points to the invalid value using its JSON path
+// inside the payload, e.g. drives[0].partitions[2].size.unit.
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Machine-readable codes describing the kind of problem.
+const (
+	// CodeRequired is used when a value is missing.
+	CodeRequired string = "required"
+	// CodeInvalidFormat is used when a value isn't written in the expected format.
+	CodeInvalidFormat string = "invalid_format"
+	// CodeUnsupported is used when a value isn't one of the supported ones.
+	CodeUnsupported string = "unsupported"
+	// CodeOutOfRange is used when a number is outside of its allowed range.
+	CodeOutOfRange string = "out_of_range"
+	// CodeInvalid is used when a value is wrong for any other reason.
+	CodeInvalid string = "invalid"
+	// CodeCheckFailed is used when a value couldn't be checked at all,
+	// e.g. because the command listing the valid values failed.
+	CodeCheckFailed string = "check_failed"
+)
+
+// Problem represents one invalid value of the payload.
+type Problem struct {
+	Path    string `json:"path"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Report collects every problem found in a payload.
+//
+// A Report is an error so it can be returned by Validate functions.
+type Report struct {
+	Problems []Problem `json:"problems"`
+}
+
+// Adds a problem to the report.
+func (r *Report) Add(path, code, message string) {
+	r.Problems = append(r.Problems, Problem{
+		Path:    path,
+		Code:    code,
+		Message: message,
+	})
+}
+
+// Returns true if no problem was found.
+func (r *Report) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+// Returns nil if the report is valid, the report itself otherwise.
+// Use it to return the report as an error.
+func (r *Report) Err() error {
+	if r.Valid() {
+		return nil
+	}
+
+	return r
+}
+
+// Error returns every problem of the report, one per line.
+func (r *Report) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d validation problem(s):", len(r.Problems))
+	for _, p := range r.Problems {
+		fmt.Fprintf(&b, "\n  %s: %s (%s)", p.Path, p.Message, p.Code)
+	}
+
+	return b.String()
+}
+
+// Returns the path of the field with the given name inside parent.
+// parent can be empty for top-level fields.
+//
+// Example:
+//
+//	Field("drives[0]", "path") == "drives[0].path"
+func Field(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+
+	return parent + "." + name
+}
+
+// Returns the path of the element at the given index of the
+// array at path.
+//
+// Example:
+//
+//	Index("drives", 0) == "drives[0]"
+func Index(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}